@@ -0,0 +1,83 @@
+package adapters
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"hole/use_cases"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	csrfCookieName = "csrf_token"
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+// CSRFToken godoc
+// @Summary      Get CSRF token
+// @Description  Issue a CSRF token in the csrf_token cookie and the response body; send it back in the X-CSRF-Token header on cookie-authenticated state-changing (POST, PUT, PATCH, DELETE) requests
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  CSRFResponse
+// @Router       /csrf [get]
+func CSRFToken(c *fiber.Ctx) error {
+	token := c.Cookies(csrfCookieName)
+	if len(token) != 64 {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "",
+				"error":   "failed to generate CSRF token",
+			})
+		}
+		token = hex.EncodeToString(b)
+	}
+
+	// Readable by scripts on purpose: the client echoes it in a header
+	c.Cookie(&fiber.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Expires:  time.Now().Add(use_cases.RefreshTokenTTL),
+		HTTPOnly: false,
+		Secure:   true,
+		SameSite: "Lax",
+	})
+
+	return c.JSON(CSRFResponse{CSRFToken: token})
+}
+
+// CSRFProtect enforces the double-submit check on state-changing requests that
+// were authenticated with cookies. Bearer-authenticated requests are exempt
+// because browsers never attach that header on their own.
+func CSRFProtect() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			return c.Next()
+		}
+
+		if !authenticatedByCookie(c) {
+			return c.Next()
+		}
+
+		header := c.Get(csrfHeaderName)
+		cookie := c.Cookies(csrfCookieName)
+		if header == "" || cookie == "" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "",
+				"error":   "missing CSRF token",
+			})
+		}
+
+		if subtle.ConstantTimeCompare([]byte(header), []byte(cookie)) != 1 {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "",
+				"error":   "invalid CSRF token",
+			})
+		}
+
+		return c.Next()
+	}
+}
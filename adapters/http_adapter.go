@@ -1,13 +1,30 @@
 package adapters
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"hole/entities"
 	"hole/use_cases"
+	"log"
+	"math"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// maxUserAgentLength caps the User-Agent stored with each session.
+const maxUserAgentLength = 512
+
+const (
+	oidcStateCookie    = "oidc_state"
+	magicBindingCookie = "magic_binding"
+)
+
 type AuthHandler struct {
 	uc *use_cases.AuthUseCase
 }
@@ -16,6 +33,52 @@ type ItemHandler struct {
 	uc *use_cases.ItemUseCase
 }
 
+type VerificationHandler struct {
+	uc *use_cases.VerificationUseCase
+}
+
+type PasswordResetHandler struct {
+	uc *use_cases.PasswordResetUseCase
+}
+
+type AccountHandler struct {
+	uc *use_cases.AccountUseCase
+}
+
+type MFAHandler struct {
+	uc *use_cases.MFAUseCase
+}
+
+type MagicLinkHandler struct {
+	uc *use_cases.MagicLinkUseCase
+}
+
+type OIDCHandler struct {
+	uc *use_cases.OIDCUseCase
+	// postLoginURL is where the browser lands after signing in.
+	postLoginURL string
+}
+
+type APIKeyHandler struct {
+	uc *use_cases.APIKeyUseCase
+}
+
+type AdminHandler struct {
+	uc *use_cases.AdminUseCase
+}
+
+type CategoryHandler struct {
+	uc *use_cases.CategoryUseCase
+}
+
+type VariantHandler struct {
+	uc *use_cases.VariantUseCase
+}
+
+type JWKSHandler struct {
+	jwt *JWTService
+}
+
 func NewAuthHandler(uc *use_cases.AuthUseCase) *AuthHandler {
 	return &AuthHandler{uc}
 }
@@ -24,6 +87,62 @@ func NewItemHandler(uc *use_cases.ItemUseCase) *ItemHandler {
 	return &ItemHandler{uc}
 }
 
+func NewVerificationHandler(uc *use_cases.VerificationUseCase) *VerificationHandler {
+	return &VerificationHandler{uc}
+}
+
+func NewPasswordResetHandler(uc *use_cases.PasswordResetUseCase) *PasswordResetHandler {
+	return &PasswordResetHandler{uc}
+}
+
+func NewAccountHandler(uc *use_cases.AccountUseCase) *AccountHandler {
+	return &AccountHandler{uc}
+}
+
+func NewMFAHandler(uc *use_cases.MFAUseCase) *MFAHandler {
+	return &MFAHandler{uc}
+}
+
+func NewMagicLinkHandler(uc *use_cases.MagicLinkUseCase) *MagicLinkHandler {
+	return &MagicLinkHandler{uc}
+}
+
+func NewOIDCHandler(uc *use_cases.OIDCUseCase, postLoginURL string) *OIDCHandler {
+	return &OIDCHandler{uc, postLoginURL}
+}
+
+func NewAPIKeyHandler(uc *use_cases.APIKeyUseCase) *APIKeyHandler {
+	return &APIKeyHandler{uc}
+}
+
+func NewCategoryHandler(uc *use_cases.CategoryUseCase) *CategoryHandler {
+	return &CategoryHandler{uc}
+}
+
+func NewVariantHandler(uc *use_cases.VariantUseCase) *VariantHandler {
+	return &VariantHandler{uc}
+}
+
+func NewAdminHandler(uc *use_cases.AdminUseCase) *AdminHandler {
+	return &AdminHandler{uc}
+}
+
+func NewJWKSHandler(jwt *JWTService) *JWKSHandler {
+	return &JWKSHandler{jwt}
+}
+
+// Get godoc
+// @Summary      JSON Web Key Set
+// @Description  Public keys for verifying access tokens issued by this API
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  JWKSet
+// @Router       /.well-known/jwks.json [get]
+func (h *JWKSHandler) Get(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(h.jwt.JWKS())
+}
+
 // Register godoc
 // @Summary      Register a new user
 // @Description  Create a new user account with email and password
@@ -32,21 +151,47 @@ func NewItemHandler(uc *use_cases.ItemUseCase) *ItemHandler {
 // @Produce      json
 // @Param        request  body      AuthRequest  true  "Registration Info"
 // @Success      200      {object}  map[string]string "message: registered"
-// @Failure      400      {object}  map[string]string "message: registration failed"
+// @Failure      400      {object}  map[string]interface{} "error: invalid email address or weak password, with reasons"
+// @Failure      409      {object}  map[string]string "error: email already registered"
 // @Router       /register [post]
 func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	var req struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
 	}
-	c.BodyParser(&req)
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "registration failed ",
+			"error":   "invalid request body",
+		})
+	}
 
 	err := h.uc.Register(req.Email, req.Password)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"message": "registration failed ",
-			"error":   err.Error(),
-		})
+		var weak *use_cases.WeakPasswordError
+		switch {
+		case errors.As(err, &weak):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "registration failed ",
+				"error":   err.Error(),
+				"reasons": weak.Reasons,
+			})
+		case errors.Is(err, use_cases.ErrInvalidEmail):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "registration failed ",
+				"error":   err.Error(),
+			})
+		case errors.Is(err, entities.ErrEmailTaken):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"message": "registration failed ",
+				"error":   err.Error(),
+			})
+		default:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "registration failed ",
+				"error":   "internal error",
+			})
+		}
 	}
 
 	return c.JSON(fiber.Map{
@@ -57,13 +202,16 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 
 // Login godoc
 // @Summary      Login user
-// @Description  Authenticate user and set auth_token and ref_token cookies
+// @Description  Authenticate user and set auth_token and ref_token cookies, or return the tokens in the body with mode=token
 // @Tags         auth
 // @Accept       json
 // @Produce      json
 // @Param        request  body      AuthRequest  true  "Login Credentials"
-// @Success      200      {object}  map[string]string "message: login successfully"
+// @Param        mode     query     string       false "Set to token to receive tokens in the response body" Enums(token)
+// @Success      200      {object}  TokenResponse "tokens when mode=token, otherwise message: login successfully"
+// @Success      202      {object}  MFAChallengeResponse "two-factor authentication required; complete with POST /login/mfa"
 // @Failure      401      {object}  map[string]string "message: fail to login"
+// @Failure      429      {object}  map[string]string "error: too many failed login attempts"
 // @Router       /login [post]
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	var req struct {
@@ -72,14 +220,140 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	}
 	c.BodyParser(&req)
 
-	access, refresh, err := h.uc.Login(req.Email, req.Password)
+	result, err := h.uc.Login(req.Email, req.Password, clientInfo(c))
 	if err != nil {
-		return c.Status(401).JSON(fiber.Map{
-			"message": "fail to login",
-			"error":   err.Error(),
+		var lockout *use_cases.LockoutError
+		switch {
+		case errors.As(err, &lockout):
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(lockout.RetryAfter.Seconds()))))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"message": "fail to login",
+				"error":   use_cases.ErrTooManyAttempts.Error(),
+			})
+		case errors.Is(err, use_cases.ErrInvalidCredentials):
+			return c.Status(401).JSON(fiber.Map{
+				"message": "fail to login",
+				"error":   err.Error(),
+			})
+		default:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "fail to login",
+				"error":   "internal error",
+			})
+		}
+	}
+
+	if result.MFAChallenge != "" {
+		return c.Status(fiber.StatusAccepted).JSON(MFAChallengeResponse{
+			MFARequired:  true,
+			MFAChallenge: result.MFAChallenge,
 		})
 	}
 
+	if wantsTokenResponse(c) {
+		return c.JSON(newTokenResponse(result.AccessToken, result.RefreshToken))
+	}
+
+	setAuthCookies(c, result.AccessToken, result.RefreshToken)
+
+	return c.JSON(fiber.Map{
+		"message": "login sucessfully ",
+		"error":   " ",
+	})
+}
+
+// Refresh godoc
+// @Summary      Refresh tokens
+// @Description  Rotate the refresh token from the ref_token cookie (or JSON body) and reissue auth_token and ref_token cookies
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      RefreshRequest  false  "Refresh token for non-browser clients"
+// @Param        mode     query     string          false  "Set to token to receive tokens in the response body" Enums(token)
+// @Success      200      {object}  TokenResponse "tokens when mode=token, otherwise message: token refreshed"
+// @Failure      400      {object}  map[string]string "error: missing refresh token"
+// @Failure      401      {object}  map[string]string "error: invalid, revoked, reused or expired refresh token"
+// @Router       /refresh [post]
+func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
+	refreshToken, err := requestRefreshToken(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "invalid request body",
+		})
+	}
+
+	if refreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "missing refresh token",
+		})
+	}
+
+	access, refresh, err := h.uc.Refresh(refreshToken, clientInfo(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, use_cases.ErrRefreshTokenInvalid),
+			errors.Is(err, use_cases.ErrRefreshTokenRevoked),
+			errors.Is(err, use_cases.ErrRefreshTokenExpired),
+			errors.Is(err, use_cases.ErrRefreshTokenReused):
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "fail to refresh",
+				"error":   err.Error(),
+			})
+		default:
+			log.Printf("refresh failed: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "fail to refresh",
+				"error":   "internal error",
+			})
+		}
+	}
+
+	if wantsTokenResponse(c) {
+		return c.JSON(newTokenResponse(access, refresh))
+	}
+
+	setAuthCookies(c, access, refresh)
+
+	return c.JSON(fiber.Map{
+		"message": "token refreshed",
+		"error":   "",
+	})
+}
+
+// requestRefreshToken reads the refresh token from the ref_token cookie or,
+// for clients in token mode, from a RefreshRequest body.
+func requestRefreshToken(c *fiber.Ctx) (string, error) {
+	if token := c.Cookies("ref_token"); token != "" {
+		return token, nil
+	}
+
+	var req RefreshRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return "", err
+		}
+	}
+	return req.RefreshToken, nil
+}
+
+// wantsTokenResponse reports whether the client asked for tokens in the body
+// instead of cookies, as CLI and server-to-server callers do.
+func wantsTokenResponse(c *fiber.Ctx) bool {
+	return c.Query("mode") == "token"
+}
+
+func newTokenResponse(access, refresh string) TokenResponse {
+	return TokenResponse{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(use_cases.AccessTokenTTL.Seconds()),
+	}
+}
+
+func setAuthCookies(c *fiber.Ctx, access, refresh string) {
 	acc := new(fiber.Cookie)
 	acc.Name = "auth_token"
 	acc.Value = access
@@ -91,20 +365,141 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	ref := new(fiber.Cookie)
 	ref.Name = "ref_token"
 	ref.Value = refresh
+	ref.Expires = time.Now().Add(use_cases.RefreshTokenTTL)
 	ref.HTTPOnly = true
 	ref.Secure = true
 	ref.SameSite = "Lax"
 
 	c.Cookie(acc)
 	c.Cookie(ref)
+}
+
+// Sessions godoc
+// @Summary      List my sessions
+// @Description  List the devices signed in to the caller's account, newest first, flagging the one making the request
+// @Tags         auth
+// @Produce      json
+// @Success      200  {array}   SessionResponse
+// @Failure      401  {object}  map[string]string "error: unauthorized"
+// @Security     BearerAuth
+// @Router       /sessions [get]
+func (h *AuthHandler) Sessions(c *fiber.Ctx) error {
+	user, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	sessions, err := h.uc.Sessions(user.UserID, user.SessionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "",
+			"error":   "failed to list sessions",
+		})
+	}
+
+	resp := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		resp = append(resp, SessionResponse{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.Current,
+		})
+	}
+	return c.JSON(resp)
+}
+
+// RevokeSession godoc
+// @Summary      Revoke a session
+// @Description  Sign one device out by revoking its refresh tokens. Its current access token stays valid until it expires
+// @Tags         auth
+// @Produce      json
+// @Param        id   path      int  true  "Session ID from GET /sessions" example(42)
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
+// @Success      200  {object}  map[string]string "message: session revoked"
+// @Failure      400  {object}  map[string]string "error: Invalid ID format"
+// @Failure      401  {object}  map[string]string "error: unauthorized"
+// @Failure      404  {object}  map[string]string "error: session not found"
+// @Security     BearerAuth
+// @Router       /sessions/{id} [delete]
+func (h *AuthHandler) RevokeSession(c *fiber.Ctx) error {
+	user, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "Invalid ID format",
+		})
+	}
+
+	if err := h.uc.RevokeSession(user.UserID, uint(id)); err != nil {
+		if errors.Is(err, entities.ErrSessionNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "",
+				"error":   err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "",
+			"error":   "failed to revoke session",
+		})
+	}
 
 	return c.JSON(fiber.Map{
-		"message": "login sucessfully ",
-		"error":   " ",
+		"message": "session revoked",
+		"error":   "",
 	})
 }
 
+// Logout godoc
+// @Summary      Logout user
+// @Description  Revoke the current refresh token and clear auth cookies; with all=true revoke every session of the user. Clients in token mode send their refresh token in the body
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        all  query     bool  false  "Log out from every device"
+// @Param        request  body  RefreshRequest  false  "Refresh token, when not sent as the ref_token cookie"
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
+// @Success      200  {object}  map[string]string "message: logged out successfully"
+// @Failure      400  {object}  map[string]string "error: invalid request body"
+// @Failure      401  {object}  map[string]string "error: unauthorized"
+// @Failure      403  {object}  map[string]string "error: missing or invalid CSRF token"
+// @Failure      500  {object}  map[string]string "error: failed to logout"
+// @Security     BearerAuth
+// @Router       /logout [post]
 func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	user, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	var err error
+	if c.QueryBool("all") {
+		err = h.uc.LogoutAll(user.UserID)
+	} else {
+		refreshToken, parseErr := requestRefreshToken(c)
+		if parseErr != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "",
+				"error":   "invalid request body",
+			})
+		}
+		err = h.uc.Logout(user.UserID, refreshToken)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "",
+			"error":   "failed to logout",
+		})
+	}
+
 	c.Cookie(&fiber.Cookie{
 		Name:     "auth_token",
 		Value:    "",
@@ -129,46 +524,1161 @@ func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 	})
 }
 
-// func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
-// 	var body struct {
-// 		RefreshToken string `json:"refresh_token"`
-// 	}
-
-// 	if err := c.BodyParser(&body); err != nil || body.RefreshToken == "" {
-// 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-// 			"error": "invalid request body",
-// 		})
-// 	}
+// Verify godoc
+// @Summary      Verify email address
+// @Description  Consume the single-use token from the verification email
+// @Tags         auth
+// @Produce      json
+// @Param        token  query     string  true  "Verification token"
+// @Success      200    {object}  map[string]string "message: email verified"
+// @Failure      400    {object}  map[string]string "error: invalid or expired token"
+// @Router       /verify [get]
+func (h *VerificationHandler) Verify(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "missing token",
+		})
+	}
+
+	if err := h.uc.Verify(token); err != nil {
+		if errors.Is(err, entities.ErrInvalidToken) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "",
+				"error":   err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "",
+			"error":   "failed to verify email",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "email verified",
+		"error":   "",
+	})
+}
+
+// Resend godoc
+// @Summary      Resend verification email
+// @Description  Send a new verification link to the authenticated user
+// @Tags         auth
+// @Produce      json
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
+// @Success      200  {object}  map[string]string "message: verification email sent"
+// @Failure      401  {object}  map[string]string "error: unauthorized"
+// @Failure      403  {object}  map[string]string "error: missing or invalid CSRF token"
+// @Failure      409  {object}  map[string]string "error: email already verified"
+// @Failure      429  {object}  map[string]string "error: verification email sent too recently"
+// @Security     BearerAuth
+// @Router       /verify/resend [post]
+func (h *VerificationHandler) Resend(c *fiber.Ctx) error {
+	user, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	if err := h.uc.Resend(user.UserID); err != nil {
+		status := fiber.StatusInternalServerError
+		switch {
+		case errors.Is(err, use_cases.ErrAlreadyVerified):
+			status = fiber.StatusConflict
+		case errors.Is(err, use_cases.ErrResendTooSoon):
+			status = fiber.StatusTooManyRequests
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"message": "",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "verification email sent",
+		"error":   "",
+	})
+}
+
+// Forgot godoc
+// @Summary      Request password reset
+// @Description  Email a single-use reset link; the response is the same whether or not the email is registered
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      ForgotPasswordRequest  true  "Account email"
+// @Success      202      {object}  map[string]string "message: if the email is registered, a reset link has been sent"
+// @Failure      400      {object}  map[string]string "error: invalid request body"
+// @Router       /password/forgot [post]
+func (h *PasswordResetHandler) Forgot(c *fiber.Ctx) error {
+	var req ForgotPasswordRequest
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "invalid request body",
+		})
+	}
+
+	// Run in the background so the response time does not depend on
+	// whether an email had to be sent.
+	go func(email string) {
+		if err := h.uc.RequestReset(email); err != nil {
+			log.Printf("password reset request failed: %v", err)
+		}
+	}(req.Email)
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "if the email is registered, a reset link has been sent",
+		"error":   "",
+	})
+}
+
+// Reset godoc
+// @Summary      Reset password
+// @Description  Set a new password with a reset token and revoke every existing session
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      ResetPasswordRequest  true  "Reset token and new password"
+// @Success      200      {object}  map[string]string "message: password reset"
+// @Failure      400      {object}  map[string]interface{} "error: invalid or expired token, or weak password"
+// @Router       /password/reset [post]
+func (h *PasswordResetHandler) Reset(c *fiber.Ctx) error {
+	var req ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "invalid request body",
+		})
+	}
+
+	if err := h.uc.ResetPassword(req.Token, req.Password); err != nil {
+		var weak *use_cases.WeakPasswordError
+		switch {
+		case errors.As(err, &weak):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "",
+				"error":   err.Error(),
+				"reasons": weak.Reasons,
+			})
+		case errors.Is(err, entities.ErrInvalidToken):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "",
+				"error":   err.Error(),
+			})
+		default:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "",
+				"error":   "failed to reset password",
+			})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "password reset",
+		"error":   "",
+	})
+}
+
+// Me godoc
+// @Summary      Get my account
+// @Description  Return the profile of the authenticated user
+// @Tags         account
+// @Produce      json
+// @Success      200  {object}  ProfileResponse
+// @Failure      401  {object}  map[string]string "error: unauthorized"
+// @Security     BearerAuth
+// @Router       /me [get]
+func (h *AccountHandler) Me(c *fiber.Ctx) error {
+	principal, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	user, err := h.uc.Profile(principal.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "",
+			"error":   "failed to load account",
+		})
+	}
+
+	return c.JSON(newProfileResponse(user))
+}
+
+// UpdateMe godoc
+// @Summary      Update my account
+// @Description  Change the display name and/or request an email change; a new email takes effect after it is confirmed through the link sent to it
+// @Tags         account
+// @Accept       json
+// @Produce      json
+// @Param        request  body      UpdateProfileRequest  true  "Fields to change"
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
+// @Success      200      {object}  ProfileResponse
+// @Failure      400      {object}  map[string]string "error: invalid request body, email address or display name"
+// @Failure      401      {object}  map[string]string "error: unauthorized"
+// @Failure      403      {object}  map[string]string "error: missing or invalid CSRF token"
+// @Failure      409      {object}  map[string]string "error: email already registered"
+// @Security     BearerAuth
+// @Router       /me [patch]
+func (h *AccountHandler) UpdateMe(c *fiber.Ctx) error {
+	principal, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	var req UpdateProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "invalid request body",
+		})
+	}
+
+	user, err := h.uc.UpdateProfile(principal.UserID, req.DisplayName, req.Email)
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		switch {
+		case errors.Is(err, use_cases.ErrInvalidEmail), errors.Is(err, use_cases.ErrInvalidDisplayName):
+			status = fiber.StatusBadRequest
+		case errors.Is(err, entities.ErrEmailTaken):
+			status = fiber.StatusConflict
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"message": "",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(newProfileResponse(user))
+}
+
+// ChangePassword godoc
+// @Summary      Change my password
+// @Description  Replace the password after checking the current one; every other session is signed out and the caller receives new tokens
+// @Tags         account
+// @Accept       json
+// @Produce      json
+// @Param        request  body      ChangePasswordRequest  true  "Current and new password"
+// @Param        mode     query     string  false  "Set to token to receive tokens in the response body" Enums(token)
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
+// @Success      200      {object}  TokenResponse "tokens when mode=token, otherwise message: password changed"
+// @Failure      400      {object}  map[string]interface{} "error: weak password, with reasons"
+// @Failure      401      {object}  map[string]string "error: unauthorized"
+// @Failure      403      {object}  map[string]string "error: current password is incorrect, or missing/invalid CSRF token"
+// @Security     BearerAuth
+// @Router       /me/password [post]
+func (h *AccountHandler) ChangePassword(c *fiber.Ctx) error {
+	principal, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	var req ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "invalid request body",
+		})
+	}
+
+	access, refresh, err := h.uc.ChangePassword(principal.UserID, req.CurrentPassword, req.NewPassword, clientInfo(c))
+	if err != nil {
+		var weak *use_cases.WeakPasswordError
+		switch {
+		case errors.As(err, &weak):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "",
+				"error":   err.Error(),
+				"reasons": weak.Reasons,
+			})
+		case errors.Is(err, use_cases.ErrWrongPassword):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "",
+				"error":   err.Error(),
+			})
+		default:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "",
+				"error":   "failed to change password",
+			})
+		}
+	}
+
+	if wantsTokenResponse(c) {
+		return c.JSON(newTokenResponse(access, refresh))
+	}
+
+	setAuthCookies(c, access, refresh)
+
+	return c.JSON(fiber.Map{
+		"message": "password changed",
+		"error":   "",
+	})
+}
+
+func newProfileResponse(user *entities.User) ProfileResponse {
+	return ProfileResponse{
+		ID:          user.ID,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		Verified:    user.Verified(),
+		Role:        string(user.Role),
+	}
+}
+
+// CompleteLogin godoc
+// @Summary      Complete a two-factor login
+// @Description  Exchange the challenge from POST /login and a TOTP or recovery code for auth_token and ref_token cookies, or tokens in the body with mode=token
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      MFALoginRequest  true  "MFA challenge and code"
+// @Param        mode     query     string           false "Set to token to receive tokens in the response body" Enums(token)
+// @Success      200      {object}  TokenResponse "tokens when mode=token, otherwise message: login successfully"
+// @Failure      400      {object}  map[string]string "error: invalid request body"
+// @Failure      401      {object}  map[string]string "error: invalid code or expired challenge"
+// @Failure      429      {object}  map[string]string "error: too many failed login attempts"
+// @Router       /login/mfa [post]
+func (h *MFAHandler) CompleteLogin(c *fiber.Ctx) error {
+	var req MFALoginRequest
+	if err := c.BodyParser(&req); err != nil || req.MFAChallenge == "" || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "invalid request body",
+		})
+	}
+
+	access, refresh, err := h.uc.CompleteLogin(req.MFAChallenge, req.Code, clientInfo(c))
+	if err != nil {
+		var lockout *use_cases.LockoutError
+		switch {
+		case errors.As(err, &lockout):
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(lockout.RetryAfter.Seconds()))))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"message": "fail to login",
+				"error":   use_cases.ErrTooManyAttempts.Error(),
+			})
+		case errors.Is(err, use_cases.ErrInvalidMFACode),
+			errors.Is(err, use_cases.ErrInvalidMFAChallenge):
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "fail to login",
+				"error":   err.Error(),
+			})
+		default:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "fail to login",
+				"error":   "internal error",
+			})
+		}
+	}
+
+	if wantsTokenResponse(c) {
+		return c.JSON(newTokenResponse(access, refresh))
+	}
+
+	setAuthCookies(c, access, refresh)
+
+	return c.JSON(fiber.Map{
+		"message": "login sucessfully ",
+		"error":   " ",
+	})
+}
+
+// Enroll godoc
+// @Summary      Start TOTP enrollment
+// @Description  Generate a TOTP secret for an authenticator app; it is enforced only after POST /mfa/totp/confirm
+// @Tags         mfa
+// @Produce      json
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
+// @Success      200      {object}  TOTPEnrollResponse
+// @Failure      401      {object}  map[string]string "error: unauthorized"
+// @Failure      409      {object}  map[string]string "error: two-factor authentication is already enabled"
+// @Security     BearerAuth
+// @Router       /mfa/totp/enroll [post]
+func (h *MFAHandler) Enroll(c *fiber.Ctx) error {
+	principal, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	enrollment, err := h.uc.Enroll(principal.UserID)
+	if err != nil {
+		return mfaError(c, err)
+	}
+
+	return c.JSON(TOTPEnrollResponse{
+		Secret:     enrollment.Secret,
+		OTPAuthURI: enrollment.URI,
+	})
+}
+
+// Confirm godoc
+// @Summary      Confirm TOTP enrollment
+// @Description  Enable two-factor authentication with a first code from the authenticator app and return single-use recovery codes, shown only once
+// @Tags         mfa
+// @Accept       json
+// @Produce      json
+// @Param        request  body      MFACodeRequest  true  "Current TOTP code"
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
+// @Success      200      {object}  RecoveryCodesResponse
+// @Failure      400      {object}  map[string]string "error: invalid code, or enrollment not started"
+// @Failure      401      {object}  map[string]string "error: unauthorized"
+// @Failure      409      {object}  map[string]string "error: two-factor authentication is already enabled"
+// @Security     BearerAuth
+// @Router       /mfa/totp/confirm [post]
+func (h *MFAHandler) Confirm(c *fiber.Ctx) error {
+	principal, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	var req MFACodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "invalid request body",
+		})
+	}
+
+	codes, err := h.uc.Confirm(principal.UserID, req.Code)
+	if err != nil {
+		return mfaError(c, err)
+	}
+
+	return c.JSON(RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// Disable godoc
+// @Summary      Disable TOTP
+// @Description  Turn off two-factor authentication after checking a current TOTP or recovery code
+// @Tags         mfa
+// @Accept       json
+// @Produce      json
+// @Param        request  body      MFACodeRequest  true  "Current TOTP code or a recovery code"
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
+// @Success      200      {object}  map[string]string "message: two-factor authentication disabled"
+// @Failure      400      {object}  map[string]string "error: invalid code, or not enrolled"
+// @Failure      401      {object}  map[string]string "error: unauthorized"
+// @Security     BearerAuth
+// @Router       /mfa/totp/disable [post]
+func (h *MFAHandler) Disable(c *fiber.Ctx) error {
+	principal, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	var req MFACodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "invalid request body",
+		})
+	}
+
+	if err := h.uc.Disable(principal.UserID, req.Code); err != nil {
+		return mfaError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "two-factor authentication disabled",
+		"error":   "",
+	})
+}
+
+// Request godoc
+// @Summary      Request a sign-in link
+// @Description  Email a single-use, short-lived sign-in link; the response is the same whether or not the email is registered. The link must be opened in the same browser
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      MagicLinkRequest  true  "Account email"
+// @Success      202      {object}  map[string]string "message: if the email is registered, a sign-in link has been sent"
+// @Failure      400      {object}  map[string]string "error: invalid request body"
+// @Router       /login/magic [post]
+func (h *MagicLinkHandler) Request(c *fiber.Ctx) error {
+	var req MagicLinkRequest
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "invalid request body",
+		})
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "",
+			"error":   "internal error",
+		})
+	}
+	binding := hex.EncodeToString(b)
+
+	// Set for every request so the response does not reveal the account
+	c.Cookie(&fiber.Cookie{
+		Name:     magicBindingCookie,
+		Value:    binding,
+		Path:     "/login/magic",
+		HTTPOnly: true,
+		Secure:   true,
+		SameSite: "Lax",
+	})
+
+	// Run in the background so the response time does not depend on
+	// whether an email had to be sent.
+	go func(email string) {
+		if err := h.uc.RequestLink(email, binding); err != nil {
+			log.Printf("magic link request failed: %v", err)
+		}
+	}(req.Email)
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "if the email is registered, a sign-in link has been sent",
+		"error":   "",
+	})
+}
+
+// Login godoc
+// @Summary      Sign in with a link
+// @Description  Exchange the token from a sign-in email for auth_token and ref_token cookies, or tokens in the body with mode=token
+// @Tags         auth
+// @Produce      json
+// @Param        token  query     string  true   "Sign-in token"
+// @Param        mode   query     string  false  "Set to token to receive tokens in the response body" Enums(token)
+// @Success      200    {object}  TokenResponse "tokens when mode=token, otherwise message: login successfully"
+// @Success      202    {object}  MFAChallengeResponse "two-factor authentication required; complete with POST /login/mfa"
+// @Failure      400    {object}  map[string]string "error: invalid or expired token, or opened in another browser"
+// @Router       /login/magic [get]
+func (h *MagicLinkHandler) Login(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "missing token",
+		})
+	}
+
+	result, err := h.uc.Login(token, c.Cookies(magicBindingCookie), clientInfo(c))
+	if err != nil {
+		if errors.Is(err, entities.ErrInvalidToken) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "fail to login",
+				"error":   err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "fail to login",
+			"error":   "internal error",
+		})
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     magicBindingCookie,
+		Value:    "",
+		Path:     "/login/magic",
+		Expires:  time.Now().Add(-time.Hour),
+		HTTPOnly: true,
+		Secure:   true,
+		SameSite: "Lax",
+	})
+
+	if result.MFAChallenge != "" {
+		return c.Status(fiber.StatusAccepted).JSON(MFAChallengeResponse{
+			MFARequired:  true,
+			MFAChallenge: result.MFAChallenge,
+		})
+	}
+
+	if wantsTokenResponse(c) {
+		return c.JSON(newTokenResponse(result.AccessToken, result.RefreshToken))
+	}
+
+	setAuthCookies(c, result.AccessToken, result.RefreshToken)
+
+	return c.JSON(fiber.Map{
+		"message": "login sucessfully ",
+		"error":   " ",
+	})
+}
+
+// Login godoc
+// @Summary      Sign in with an identity provider
+// @Description  Redirect the browser to the OpenID Connect provider using the authorization code flow with PKCE
+// @Tags         auth
+// @Param        provider  path  string  true  "Provider name from OIDC_PROVIDERS" example(google)
+// @Success      302  "redirect to the provider"
+// @Failure      404  {object}  map[string]string "error: unknown identity provider"
+// @Failure      502  {object}  map[string]string "error: identity provider sign-in failed"
+// @Router       /auth/oidc/{provider}/login [get]
+func (h *OIDCHandler) Login(c *fiber.Ctx) error {
+	authURL, state, err := h.uc.Begin(c.Params("provider"))
+	if err != nil {
+		return oidcError(c, err)
+	}
+
+	// Binds the callback to the browser that started the sign-in
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/oidc",
+		Expires:  time.Now().Add(use_cases.OIDCStateTTL),
+		HTTPOnly: true,
+		Secure:   true,
+		SameSite: "Lax",
+	})
+
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// Callback godoc
+// @Summary      Identity provider callback
+// @Description  Complete the sign-in, set auth_token and ref_token cookies and redirect to the app. Accounts with two-factor authentication are redirected with #mfa_challenge=... for POST /login/mfa instead
+// @Tags         auth
+// @Param        provider  path   string  true   "Provider name" example(google)
+// @Param        code      query  string  true   "Authorization code"
+// @Param        state     query  string  true   "State from the login redirect"
+// @Success      302  "redirect to the app"
+// @Failure      400  {object}  map[string]string "error: invalid or expired sign-in state"
+// @Failure      403  {object}  map[string]string "error: email not verified by the provider"
+// @Failure      409  {object}  map[string]string "error: an unverified account already uses this email"
+// @Failure      502  {object}  map[string]string "error: identity provider sign-in failed"
+// @Router       /auth/oidc/{provider}/callback [get]
+func (h *OIDCHandler) Callback(c *fiber.Ctx) error {
+	if reason := c.Query("error"); reason != "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "fail to login",
+			"error":   "identity provider returned " + reason,
+		})
+	}
+
+	state := c.Query("state")
+	cookie := c.Cookies(oidcStateCookie)
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    "",
+		Path:     "/auth/oidc",
+		Expires:  time.Now().Add(-time.Hour),
+		HTTPOnly: true,
+		Secure:   true,
+		SameSite: "Lax",
+	})
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookie)) != 1 {
+		return oidcError(c, use_cases.ErrInvalidOIDCState)
+	}
+
+	result, err := h.uc.Complete(c.UserContext(), c.Params("provider"), state, c.Query("code"), clientInfo(c))
+	if err != nil {
+		return oidcError(c, err)
+	}
+
+	if result.MFAChallenge != "" {
+		// A fragment never reaches server logs
+		return c.Redirect(h.postLoginURL+"#mfa_challenge="+url.QueryEscape(result.MFAChallenge), fiber.StatusFound)
+	}
+
+	setAuthCookies(c, result.AccessToken, result.RefreshToken)
+	return c.Redirect(h.postLoginURL, fiber.StatusFound)
+}
+
+// Create godoc
+// @Summary      Create an API key
+// @Description  Issue a personal API key for scripts and CI. Send it in the X-API-Key header. The key is shown only in this response
+// @Tags         api-keys
+// @Accept       json
+// @Produce      json
+// @Param        request  body      CreateAPIKeyRequest  true  "Name, scopes (items:read, items:write, images:write) and optional expiry"
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
+// @Success      201      {object}  APIKeyResponse
+// @Failure      400      {object}  map[string]string "error: invalid name, scopes or expiry"
+// @Failure      401      {object}  map[string]string "error: unauthorized"
+// @Failure      403      {object}  map[string]string "error: missing or invalid CSRF token"
+// @Security     BearerAuth
+// @Router       /api-keys [post]
+func (h *APIKeyHandler) Create(c *fiber.Ctx) error {
+	principal, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "invalid request body",
+		})
+	}
+
+	key, err := h.uc.Create(principal.UserID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, use_cases.ErrInvalidAPIKeyName),
+			errors.Is(err, use_cases.ErrInvalidScope),
+			errors.Is(err, use_cases.ErrInvalidAPIKeyExpiry):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "",
+				"error":   err.Error(),
+			})
+		default:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "",
+				"error":   "failed to create api key",
+			})
+		}
+	}
+
+	resp := newAPIKeyResponse(key)
+	resp.Key = key.Key
+	return c.Status(fiber.StatusCreated).JSON(resp)
+}
+
+// List godoc
+// @Summary      List my API keys
+// @Description  List the caller's API keys that have not been revoked. Keys themselves are never returned again
+// @Tags         api-keys
+// @Produce      json
+// @Success      200  {array}   APIKeyResponse
+// @Failure      401  {object}  map[string]string "error: unauthorized"
+// @Security     BearerAuth
+// @Router       /api-keys [get]
+func (h *APIKeyHandler) List(c *fiber.Ctx) error {
+	principal, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	keys, err := h.uc.List(principal.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "",
+			"error":   "failed to list api keys",
+		})
+	}
+
+	resp := make([]APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		resp = append(resp, newAPIKeyResponse(key))
+	}
+	return c.JSON(resp)
+}
+
+// Revoke godoc
+// @Summary      Revoke an API key
+// @Description  Revoke one of the caller's API keys; it stops working immediately
+// @Tags         api-keys
+// @Produce      json
+// @Param        id   path      int  true  "API key ID" example(1)
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
+// @Success      200  {object}  map[string]string "message: api key revoked"
+// @Failure      400  {object}  map[string]string "error: Invalid ID format"
+// @Failure      401  {object}  map[string]string "error: unauthorized"
+// @Failure      404  {object}  map[string]string "error: api key not found"
+// @Security     BearerAuth
+// @Router       /api-keys/{id} [delete]
+func (h *APIKeyHandler) Revoke(c *fiber.Ctx) error {
+	principal, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "Invalid ID format",
+		})
+	}
+
+	if err := h.uc.Revoke(principal.UserID, uint(id)); err != nil {
+		if errors.Is(err, entities.ErrAPIKeyNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "",
+				"error":   err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "",
+			"error":   "failed to revoke api key",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "api key revoked",
+		"error":   "",
+	})
+}
+
+func newAPIKeyResponse(key *entities.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.ScopeList(),
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+// AssignRole godoc
+// @Summary      Assign a role
+// @Description  Set a user's role to viewer, editor or admin. The user's current access tokens stop working and the new role applies from their next refresh
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int                true  "User ID" example(2)
+// @Param        request  body      AssignRoleRequest  true  "New role"
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
+// @Success      200      {object}  ProfileResponse
+// @Failure      400      {object}  map[string]string "error: invalid role, or admins cannot change their own role"
+// @Failure      401      {object}  map[string]string "error: unauthorized"
+// @Failure      403      {object}  map[string]string "error: insufficient role, or missing/invalid CSRF token"
+// @Failure      404      {object}  map[string]string "error: user not found"
+// @Security     BearerAuth
+// @Router       /admin/users/{id}/role [put]
+func (h *AdminHandler) AssignRole(c *fiber.Ctx) error {
+	principal, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "Invalid ID format",
+		})
+	}
+
+	var req AssignRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "invalid request body",
+		})
+	}
+
+	user, err := h.uc.AssignRole(principal.UserID, uint(id), entities.Role(req.Role))
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		message := "failed to assign role"
+		switch {
+		case errors.Is(err, entities.ErrInvalidRole),
+			errors.Is(err, use_cases.ErrCannotChangeOwnRole):
+			status = fiber.StatusBadRequest
+			message = err.Error()
+		case errors.Is(err, entities.ErrUserNotFound):
+			status = fiber.StatusNotFound
+			message = err.Error()
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"message": "",
+			"error":   message,
+		})
+	}
+
+	return c.JSON(newProfileResponse(user))
+}
+
+// Lockouts godoc
+// @Summary      List login lockouts
+// @Description  List the accounts and client IPs currently locked out after repeated failed logins
+// @Tags         admin
+// @Produce      json
+// @Success      200  {array}   LockoutResponse
+// @Failure      401  {object}  map[string]string "error: unauthorized"
+// @Failure      403  {object}  map[string]string "error: insufficient role"
+// @Security     BearerAuth
+// @Router       /admin/lockouts [get]
+func (h *AdminHandler) Lockouts(c *fiber.Ctx) error {
+	attempts, err := h.uc.Lockouts()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "",
+			"error":   "failed to list lockouts",
+		})
+	}
+
+	lockouts := make([]LockoutResponse, 0, len(attempts))
+	for _, a := range attempts {
+		lockouts = append(lockouts, LockoutResponse{
+			Key:         a.Key,
+			Failures:    a.Failures,
+			LockedUntil: a.LockedUntil,
+		})
+	}
+	return c.JSON(lockouts)
+}
+
+// Unlock godoc
+// @Summary      Clear a login lockout
+// @Description  Reset the failed login counter for a key returned by GET /admin/lockouts
+// @Tags         admin
+// @Produce      json
+// @Param        key  query     string  true  "Lockout key" example(account:test@example.com)
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
+// @Success      200  {object}  map[string]string "message: lockout cleared"
+// @Failure      400  {object}  map[string]string "error: missing key"
+// @Failure      401  {object}  map[string]string "error: unauthorized"
+// @Failure      403  {object}  map[string]string "error: insufficient role, or missing/invalid CSRF token"
+// @Security     BearerAuth
+// @Router       /admin/lockouts [delete]
+func (h *AdminHandler) Unlock(c *fiber.Ctx) error {
+	key := c.Query("key")
+	if key == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "missing key",
+		})
+	}
+
+	if err := h.uc.Unlock(key); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "",
+			"error":   "failed to clear lockout",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "lockout cleared",
+		"error":   "",
+	})
+}
+
+// List godoc
+// @Summary      List categories
+// @Description  List all categories ordered by name. The tree is given by parentId, which is null for root categories
+// @Tags         categories
+// @Produce      json
+// @Success      200  {object}  map[string]interface{} "message: [categories...]"
+// @Failure      500  {object}  map[string]interface{}
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /categories [get]
+func (h *CategoryHandler) List(c *fiber.Ctx) error {
+	categories, err := h.uc.List()
+	if err != nil {
+		return categoryError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": categories,
+		"error":   "",
+	})
+}
+
+// Get godoc
+// @Summary      Get a category
+// @Tags         categories
+// @Produce      json
+// @Param        id   path      int  true  "Category ID" example(1)
+// @Success      200  {object}  map[string]interface{} "message: category"
+// @Failure      400  {object}  map[string]string "error: Invalid ID format"
+// @Failure      404  {object}  map[string]string "error: category not found"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /categories/{id} [get]
+func (h *CategoryHandler) Get(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "Invalid ID format",
+		})
+	}
+
+	category, err := h.uc.Get(uint(id))
+	if err != nil {
+		return categoryError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": category,
+		"error":   "",
+	})
+}
+
+// Create godoc
+// @Summary      Create a category
+// @Description  Add a category, below parentId or at the root. The slug is derived from the name when omitted. Requires the admin role
+// @Tags         categories
+// @Accept       json
+// @Produce      json
+// @Param        request  body      CategoryRequest  true  "Category"
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
+// @Success      201  {object}  map[string]interface{} "message: category"
+// @Failure      400  {object}  map[string]string "error: invalid name or slug, or unknown parent"
+// @Failure      403  {object}  map[string]string "error: insufficient role, or missing/invalid CSRF token"
+// @Failure      409  {object}  map[string]string "error: category slug already in use"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /categories [post]
+func (h *CategoryHandler) Create(c *fiber.Ctx) error {
+	var req CategoryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "invalid request body",
+		})
+	}
+
+	category, err := h.uc.Create(req.Name, req.Slug, req.ParentID)
+	if errors.Is(err, entities.ErrCategoryNotFound) {
+		// Only the parent can be missing here
+		err = errUnknownParent
+	}
+	if err != nil {
+		return categoryError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": category,
+		"error":   "",
+	})
+}
+
+// Update godoc
+// @Summary      Update a category
+// @Description  Replace the name, slug and parent of a category; a null parentId moves it to the root. Its subcategories move along. Requires the admin role
+// @Tags         categories
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int              true  "Category ID" example(1)
+// @Param        request  body      CategoryRequest  true  "Category"
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
+// @Success      200  {object}  map[string]interface{} "message: category"
+// @Failure      400  {object}  map[string]string "error: invalid name, slug or parent"
+// @Failure      403  {object}  map[string]string "error: insufficient role, or missing/invalid CSRF token"
+// @Failure      404  {object}  map[string]string "error: category not found"
+// @Failure      409  {object}  map[string]string "error: category slug already in use"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /categories/{id} [put]
+func (h *CategoryHandler) Update(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "Invalid ID format",
+		})
+	}
+
+	var req CategoryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "invalid request body",
+		})
+	}
+
+	if _, err := h.uc.Get(uint(id)); err != nil {
+		return categoryError(c, err)
+	}
+	category, err := h.uc.Update(uint(id), req.Name, req.Slug, req.ParentID)
+	if errors.Is(err, entities.ErrCategoryNotFound) && req.ParentID != nil {
+		err = errUnknownParent
+	}
+	if err != nil {
+		return categoryError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": category,
+		"error":   "",
+	})
+}
+
+// Delete godoc
+// @Summary      Delete a category
+// @Description  Remove a category that has no subcategories and no items. Requires the admin role
+// @Tags         categories
+// @Produce      json
+// @Param        id   path      int  true  "Category ID" example(1)
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
+// @Success      200  {object}  map[string]string "message: category deleted"
+// @Failure      400  {object}  map[string]string "error: Invalid ID format"
+// @Failure      403  {object}  map[string]string "error: insufficient role, or missing/invalid CSRF token"
+// @Failure      404  {object}  map[string]string "error: category not found"
+// @Failure      409  {object}  map[string]string "error: category still has subcategories or items"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /categories/{id} [delete]
+func (h *CategoryHandler) Delete(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "Invalid ID format",
+		})
+	}
+
+	if err := h.uc.Delete(uint(id)); err != nil {
+		return categoryError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "category deleted",
+		"error":   "",
+	})
+}
+
+var errUnknownParent = errors.New("parent category not found")
 
-// 	access, refresh, err := h.uc.Refresh(body.RefreshToken)
-// 	if err != nil {
-// 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-// 			"error": err.Error(),
-// 		})
-// 	}
+// categoryError maps category use case errors to their HTTP status.
+func categoryError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	message := "internal error"
+	switch {
+	case errors.Is(err, use_cases.ErrInvalidCategory),
+		errors.Is(err, use_cases.ErrCategoryCycle),
+		errors.Is(err, errUnknownParent):
+		status = fiber.StatusBadRequest
+		message = err.Error()
+	case errors.Is(err, entities.ErrCategoryNotFound):
+		status = fiber.StatusNotFound
+		message = err.Error()
+	case errors.Is(err, entities.ErrSlugTaken),
+		errors.Is(err, use_cases.ErrCategoryNotEmpty):
+		status = fiber.StatusConflict
+		message = err.Error()
+	}
 
-// 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-// 		"access_token":  access,
-// 		"refresh_token": refresh,
-// 	})
-// }
+	return c.Status(status).JSON(fiber.Map{
+		"message": "",
+		"error":   message,
+	})
+}
 
 // Create godoc
 // @Summary      Create Item
-// @Description  Add a new item to the store
+// @Description  Add a new item to the store, optionally with a price, initial stock, category and tags. Prices are integers in the minor unit of an ISO 4217 currency. Unknown tags are created. Requires the editor role
 // @Tags         items
 // @Accept       json
 // @Produce      json
 // @Param        request body      CreateItemRequest  true "Item Details"
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
 // @Success      201     {string}  map[string]string "message: item created"
-// @Failure      400     {object}  map[string]string "error: invalid request body"
+// @Failure      400     {object}  map[string]string "error: invalid request body, price, currency, stock, category or tags"
+// @Failure      401     {object}  map[string]string "error: unauthorized"
+// @Failure      403     {object}  map[string]string "error: insufficient role, or missing/invalid CSRF token"
 // @Failure      500     {object}  map[string]string "error: failed to create item"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
 // @Router       /items [post]
 func (h *ItemHandler) Create(c *fiber.Ctx) error {
+	user, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
 	var req struct {
-		ProductName     string `json:"productName"`
-		ProductDesc     string `json:"productDesc"`
-		ProductImageKey string `json:"productImageKey"`
+		ProductName     string   `json:"productName"`
+		ProductDesc     string   `json:"productDesc"`
+		ProductImageKey string   `json:"productImageKey"`
+		CategoryID      *uint    `json:"categoryId"`
+		Tags            []string `json:"tags"`
+		PriceMinor      *int64   `json:"priceMinor"`
+		Currency        string   `json:"currency"`
+		Stock           int      `json:"stock"`
 	}
 
 	if err := c.BodyParser(&req); err != nil {
@@ -195,7 +1705,22 @@ func (h *ItemHandler) Create(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := h.uc.CreateItem(req.ProductName, req.ProductDesc, c.UserContext(), req.ProductImageKey); err != nil {
+	err := h.uc.CreateItem(c.UserContext(), user.UserID, use_cases.ItemFields{
+		Name:       req.ProductName,
+		Desc:       req.ProductDesc,
+		ImageKey:   req.ProductImageKey,
+		CategoryID: req.CategoryID,
+		Tags:       req.Tags,
+		PriceMinor: req.PriceMinor,
+		Currency:   req.Currency,
+		Stock:      req.Stock,
+	})
+	if isItemInputError(err) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to create item",
 		})
@@ -207,41 +1732,207 @@ func (h *ItemHandler) Create(c *fiber.Ctx) error {
 }
 
 // List godoc
-// @Summary      List all items
-// @Description  Fetch all products from the database
+// @Summary      List items
+// @Description  Fetch one page of products. Pages are addressed either by cursor (preferred) or by offset; nextCursor is empty on the last page
 // @Tags         items
 // @Produce      json
-// @Success      200  {object}  map[string]interface{} "message: [items...]"
+// @Param        limit   query     int     false  "Page size, at most 100" default(20)
+// @Param        offset  query     int     false  "Number of items to skip; cannot be combined with cursor"
+// @Param        cursor  query     string  false  "nextCursor from the previous page"
+// @Param        sort    query     string  false  "id, name or created; prefix with - for descending" default(id)
+// @Param        name    query     string  false  "Case-insensitive name prefix"
+// @Param        category  query   string  false  "Category slug; items of its subcategories are included"
+// @Param        tags    query     string  false  "Comma-separated tags that every item must carry"
+// @Param        variants  query   bool    false  "Include the variants of each item" default(true)
+// @Param        owner   query     int     false  "Owner user ID"
+// @Success      200  {object}  map[string]interface{} "message: [items...], meta: PageMeta"
+// @Failure      400  {object}  map[string]interface{}
 // @Failure      500  {object}  map[string]interface{}
+// @Security     BearerAuth
+// @Security     APIKeyAuth
 // @Router       /items [get]
 func (h *ItemHandler) List(c *fiber.Ctx) error {
-	items, err := h.uc.GetAllItems()
+	params, err := itemListParams(c)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": []interface{}{},
-			"error":   err,
-		})
+		return itemListError(c, err)
+	}
+	return h.list(c, params)
+}
+
+// Mine godoc
+// @Summary      List my items
+// @Description  Fetch one page of the products owned by the authenticated user; accepts the same query parameters as GET /items except owner
+// @Tags         items
+// @Produce      json
+// @Param        limit   query     int     false  "Page size, at most 100" default(20)
+// @Param        offset  query     int     false  "Number of items to skip; cannot be combined with cursor"
+// @Param        cursor  query     string  false  "nextCursor from the previous page"
+// @Param        sort    query     string  false  "id, name or created; prefix with - for descending" default(id)
+// @Param        name    query     string  false  "Case-insensitive name prefix"
+// @Param        category  query   string  false  "Category slug; items of its subcategories are included"
+// @Param        tags    query     string  false  "Comma-separated tags that every item must carry"
+// @Param        variants  query   bool    false  "Include the variants of each item" default(true)
+// @Success      200  {object}  map[string]interface{} "message: [items...], meta: PageMeta"
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      401  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /items/mine [get]
+func (h *ItemHandler) Mine(c *fiber.Ctx) error {
+	user, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	params, err := itemListParams(c)
+	if err != nil {
+		return itemListError(c, err)
+	}
+	params.OwnerID = user.UserID
+	return h.list(c, params)
+}
+
+// Search godoc
+// @Summary      Search items
+// @Description  Full-text search over product names and descriptions, best matches first. Every word must match; the last word also matches longer words unless the query ends with a space. Snippets are HTML with matches wrapped in <mark> tags
+// @Tags         items
+// @Produce      json
+// @Param        q       query     string  true   "Search text" example(iph)
+// @Param        limit   query     int     false  "Page size, at most 100" default(20)
+// @Param        offset  query     int     false  "Number of results to skip"
+// @Param        variants  query   bool    false  "Include the variants of each item" default(true)
+// @Success      200  {object}  map[string]interface{} "message: [items with rank and snippet...], meta: PageMeta"
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /items/search [get]
+func (h *ItemHandler) Search(c *fiber.Ctx) error {
+	params, err := itemListParams(c)
+	if err != nil {
+		return itemListError(c, err)
+	}
+
+	page, err := h.uc.SearchItems(use_cases.ItemSearchParams{
+		Query:           c.Query("q"),
+		Limit:           params.Limit,
+		Offset:          params.Offset,
+		ExcludeVariants: params.ExcludeVariants,
+	})
+	if err != nil {
+		return itemListError(c, err)
 	}
 
 	return c.JSON(fiber.Map{
-		"message": items,
-		"error":   "",
+		"message": page.Hits,
+		"meta": PageMeta{
+			Limit:         page.Limit,
+			Offset:        page.Offset,
+			TotalEstimate: page.TotalEstimate,
+		},
+		"error": "",
+	})
+}
+
+func (h *ItemHandler) list(c *fiber.Ctx, params use_cases.ItemListParams) error {
+	page, err := h.uc.ListItems(params)
+	if err != nil {
+		return itemListError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": page.Items,
+		"meta": PageMeta{
+			Limit:         page.Limit,
+			Offset:        page.Offset,
+			NextCursor:    page.NextCursor,
+			TotalEstimate: page.TotalEstimate,
+		},
+		"error": "",
+	})
+}
+
+// itemListParams reads the listing query parameters shared by List and Mine.
+func itemListParams(c *fiber.Ctx) (use_cases.ItemListParams, error) {
+	params := use_cases.ItemListParams{
+		NamePrefix:      c.Query("name"),
+		Category:        c.Query("category"),
+		Sort:            c.Query("sort"),
+		Cursor:          c.Query("cursor"),
+		ExcludeVariants: !c.QueryBool("variants", true),
+	}
+	if tags := c.Query("tags"); tags != "" {
+		params.Tags = strings.Split(tags, ",")
+	}
+
+	for _, q := range []struct {
+		name string
+		dst  *int
+	}{{"limit", &params.Limit}, {"offset", &params.Offset}} {
+		if raw := c.Query(q.name); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return params, use_cases.ErrInvalidPage
+			}
+			*q.dst = n
+		}
+	}
+
+	if raw := c.Query("owner"); raw != "" {
+		owner, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil || owner == 0 {
+			return params, errInvalidOwner
+		}
+		params.OwnerID = uint(owner)
+	}
+
+	return params, nil
+}
+
+var errInvalidOwner = errors.New("owner must be a positive user ID")
+
+func itemListError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, use_cases.ErrInvalidCursor),
+		errors.Is(err, use_cases.ErrInvalidSort),
+		errors.Is(err, use_cases.ErrInvalidPage),
+		errors.Is(err, use_cases.ErrEmptySearch),
+		errors.Is(err, use_cases.ErrInvalidTags),
+		errors.Is(err, errInvalidOwner):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": []interface{}{},
+			"error":   err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"message": []interface{}{},
+		"error":   "failed to list items",
 	})
 }
 
 // Update godoc
 // @Summary      Update Item
-// @Description  Update product name and description by ID
+// @Description  Update the product name, description, price, currency, category and tags by ID; omitted fields are unchanged. Stock cannot be set here and is rejected; it changes through POST /items/{id}/inventory. A categoryId of 0 removes the category and an empty tags array removes all tags. Requires the editor role and ownership of the item
 // @Tags         items
 // @Accept       json
 // @Produce      json
 // @Param        id      path      int          true  "Product ID" example(1)
 // @Param        request body      UpdateItemRequest  true  "New Item Data"
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
 // @Success      200     {object}  map[string]string "message: item updated"
-// @Failure      400     {object}  map[string]string "error: Invalid ID format"
-// @Failure      403     {object}  map[string]string "error: forbidden"
+// @Failure      400     {object}  map[string]string "error: Invalid ID format, invalid request body, stock in the body, or invalid price, currency, category or tags"
+// @Failure      403     {object}  map[string]string "error: forbidden, insufficient role, or missing/invalid CSRF token"
+// @Failure      404     {object}  map[string]string "error: item not found"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
 // @Router       /items/{id} [put]
 func (h *ItemHandler) Update(c *fiber.Ctx) error {
+	user, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
 	id, err := c.ParamsInt("id")
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -250,25 +1941,43 @@ func (h *ItemHandler) Update(c *fiber.Ctx) error {
 	}
 
 	var req struct {
-		ProductName     string `json:"productName"`
-		ProductDesc     string `json:"productDesc"`
-		ProductImageKey string `json:"productImageKey"`
+		ProductName     string   `json:"productName"`
+		ProductDesc     string   `json:"productDesc"`
+		ProductImageKey string   `json:"productImageKey"`
+		CategoryID      *uint    `json:"categoryId"`
+		Tags            []string `json:"tags"`
+		PriceMinor      *int64   `json:"priceMinor"`
+		Currency        string   `json:"currency"`
+		// Stock is only read to refuse it; see AdjustInventory.
+		Stock *int `json:"stock"`
 	}
 
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"message": " ",
-			"error":   err,
+			"error":   "invalid request body",
 		})
 	}
-
-	if err := h.uc.UpdateItem(uint(id), req.ProductName, req.ProductDesc, req.ProductImageKey); err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+	if req.Stock != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"message": " ",
-			"error":   err,
+			"error":   "stock cannot be set here; adjust it through POST /items/{id}/inventory",
 		})
 	}
 
+	err = h.uc.UpdateItem(user.UserID, uint(id), use_cases.ItemFields{
+		Name:       req.ProductName,
+		Desc:       req.ProductDesc,
+		ImageKey:   req.ProductImageKey,
+		CategoryID: req.CategoryID,
+		Tags:       req.Tags,
+		PriceMinor: req.PriceMinor,
+		Currency:   req.Currency,
+	})
+	if err != nil {
+		return itemError(c, err)
+	}
+
 	return c.JSON(fiber.Map{
 		"message": "item updated",
 		"error":   "",
@@ -277,14 +1986,23 @@ func (h *ItemHandler) Update(c *fiber.Ctx) error {
 
 // Delete godoc
 // @Summary      Delete an item
-// @Description  Remove a product by ID
+// @Description  Remove a product by ID. Editors may delete their own items; admins may delete any item
 // @Tags         items
 // @Param        id   path      int  true  "Item ID" example(1)
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
 // @Success      200  {object}  map[string]string "message: item deleted"
 // @Failure      400  {object}  map[string]string "error: Invalid ID format"
-// @Failure      403  {object}  map[string]string "error: forbidden"
+// @Failure      403  {object}  map[string]string "error: forbidden, insufficient role, or missing/invalid CSRF token"
+// @Failure      404  {object}  map[string]string "error: item not found"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
 // @Router       /items/{id} [delete]
 func (h *ItemHandler) Delete(c *fiber.Ctx) error {
+	user, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
 	id, err := c.ParamsInt("id")
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -293,19 +2011,339 @@ func (h *ItemHandler) Delete(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := h.uc.DeleteItem(uint(id)); err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+	if err := h.uc.DeleteItem(user.UserID, user.Role, uint(id)); err != nil {
+		return itemError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "item deleted",
+		"error":   "",
+	})
+}
+
+// AdjustInventory godoc
+// @Summary      Adjust item stock
+// @Description  Add to or remove from the stock of an item, or of one of its variants when variantId is given, and record the change in the inventory ledger of the item. Concurrent adjustments are serialized, and an adjustment that would make the stock negative is rejected. Requires the editor role and ownership of the item; admins may adjust any item
+// @Tags         items
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int                         true  "Product ID" example(1)
+// @Param        request  body      InventoryAdjustmentRequest  true  "Stock change"
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
+// @Success      201  {object}  map[string]interface{} "message: adjustment with stockAfter"
+// @Failure      400  {object}  map[string]string "error: invalid delta, reason or note"
+// @Failure      403  {object}  map[string]string "error: forbidden, insufficient role, or missing/invalid CSRF token"
+// @Failure      404  {object}  map[string]string "error: item or variant not found"
+// @Failure      409  {object}  map[string]string "error: insufficient stock"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /items/{id}/inventory [post]
+func (h *ItemHandler) AdjustInventory(c *fiber.Ctx) error {
+	user, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": " ",
+			"error":   "Invalid ID format",
+		})
+	}
+
+	var req InventoryAdjustmentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": " ",
+			"error":   "invalid request body",
+		})
+	}
+
+	adj, err := h.uc.AdjustStock(user.UserID, user.Role, uint(id), req.VariantID, req.Delta, entities.InventoryReason(req.Reason), req.Note)
+	if err != nil {
+		return itemError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": adj,
+		"error":   "",
+	})
+}
+
+// Inventory godoc
+// @Summary      Item inventory ledger
+// @Description  List the latest stock adjustments of an item, newest first. Available to the owner of the item and admins
+// @Tags         items
+// @Produce      json
+// @Param        id     path      int  true   "Product ID" example(1)
+// @Param        limit  query     int  false  "Number of entries, at most 100" default(50)
+// @Success      200  {object}  map[string]interface{} "message: [adjustments...]"
+// @Failure      400  {object}  map[string]string "error: Invalid ID format"
+// @Failure      403  {object}  map[string]string "error: forbidden"
+// @Failure      404  {object}  map[string]string "error: item not found"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /items/{id}/inventory [get]
+func (h *ItemHandler) Inventory(c *fiber.Ctx) error {
+	user, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"message": " ",
-			"error":   err,
+			"error":   "Invalid ID format",
 		})
 	}
 
+	limit, err := strconv.Atoi(c.Query("limit", "0"))
+	if err != nil {
+		return itemError(c, use_cases.ErrInvalidPage)
+	}
+
+	history, err := h.uc.InventoryHistory(user.UserID, user.Role, uint(id), limit)
+	if err != nil {
+		return itemError(c, err)
+	}
+
 	return c.JSON(fiber.Map{
-		"message": "item deleted",
+		"message": history,
+		"error":   "",
+	})
+}
+
+// List godoc
+// @Summary      List item variants
+// @Tags         variants
+// @Produce      json
+// @Param        id   path      int  true  "Product ID" example(1)
+// @Success      200  {object}  map[string]interface{} "message: [variants...]"
+// @Failure      400  {object}  map[string]string "error: Invalid ID format"
+// @Failure      404  {object}  map[string]string "error: item not found"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /items/{id}/variants [get]
+func (h *VariantHandler) List(c *fiber.Ctx) error {
+	itemID, err := c.ParamsInt("id")
+	if err != nil || itemID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "Invalid ID format",
+		})
+	}
+
+	variants, err := h.uc.List(uint(itemID))
+	if err != nil {
+		return variantError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": variants,
+		"error":   "",
+	})
+}
+
+// Get godoc
+// @Summary      Get an item variant
+// @Tags         variants
+// @Produce      json
+// @Param        id         path      int  true  "Product ID" example(1)
+// @Param        variantId  path      int  true  "Variant ID" example(1)
+// @Success      200  {object}  map[string]interface{} "message: variant"
+// @Failure      400  {object}  map[string]string "error: Invalid ID format"
+// @Failure      404  {object}  map[string]string "error: variant not found"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /items/{id}/variants/{variantId} [get]
+func (h *VariantHandler) Get(c *fiber.Ctx) error {
+	itemID, id, ok := variantID(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "Invalid ID format",
+		})
+	}
+
+	variant, err := h.uc.Get(itemID, id)
+	if err != nil {
+		return variantError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": variant,
+		"error":   "",
+	})
+}
+
+// Create godoc
+// @Summary      Create an item variant
+// @Description  Add a variant with its own SKU, options, optional price override in the currency of the item, initial stock and image. Requires the editor role and ownership of the item; admins may add variants to any item
+// @Tags         variants
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int             true  "Product ID" example(1)
+// @Param        request  body      VariantRequest  true  "Variant"
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
+// @Success      201  {object}  map[string]interface{} "message: variant"
+// @Failure      400  {object}  map[string]string "error: invalid SKU, options, price or stock"
+// @Failure      403  {object}  map[string]string "error: forbidden, insufficient role, or missing/invalid CSRF token"
+// @Failure      404  {object}  map[string]string "error: item not found"
+// @Failure      409  {object}  map[string]string "error: SKU already in use or duplicate options"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /items/{id}/variants [post]
+func (h *VariantHandler) Create(c *fiber.Ctx) error {
+	user, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	itemID, err := c.ParamsInt("id")
+	if err != nil || itemID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "Invalid ID format",
+		})
+	}
+
+	var req VariantRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "invalid request body",
+		})
+	}
+
+	variant, err := h.uc.Create(user.UserID, user.Role, uint(itemID), use_cases.VariantFields{
+		SKU:        req.SKU,
+		Options:    req.Options,
+		PriceMinor: req.PriceMinor,
+		ImageKey:   req.ImageKey,
+		Stock:      req.Stock,
+	})
+	if err != nil {
+		return variantError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": variant,
+		"error":   "",
+	})
+}
+
+// Update godoc
+// @Summary      Update an item variant
+// @Description  Replace the SKU, options, price override and image of a variant; a null priceMinor falls back to the item price. Stock changes through POST /items/{id}/inventory. Requires the editor role and ownership of the item; admins may update any variant
+// @Tags         variants
+// @Accept       json
+// @Produce      json
+// @Param        id         path      int             true  "Product ID" example(1)
+// @Param        variantId  path      int             true  "Variant ID" example(1)
+// @Param        request    body      VariantRequest  true  "Variant; stock is ignored"
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
+// @Success      200  {object}  map[string]interface{} "message: variant"
+// @Failure      400  {object}  map[string]string "error: invalid SKU, options or price"
+// @Failure      403  {object}  map[string]string "error: forbidden, insufficient role, or missing/invalid CSRF token"
+// @Failure      404  {object}  map[string]string "error: item or variant not found"
+// @Failure      409  {object}  map[string]string "error: SKU already in use or duplicate options"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /items/{id}/variants/{variantId} [put]
+func (h *VariantHandler) Update(c *fiber.Ctx) error {
+	user, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	itemID, id, ok := variantID(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "Invalid ID format",
+		})
+	}
+
+	var req VariantRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "invalid request body",
+		})
+	}
+
+	variant, err := h.uc.Update(user.UserID, user.Role, itemID, id, use_cases.VariantFields{
+		SKU:        req.SKU,
+		Options:    req.Options,
+		PriceMinor: req.PriceMinor,
+		ImageKey:   req.ImageKey,
+	})
+	if err != nil {
+		return variantError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": variant,
+		"error":   "",
+	})
+}
+
+// Delete godoc
+// @Summary      Delete an item variant
+// @Description  Remove a variant. Its entries in the inventory ledger are kept. Requires the editor role and ownership of the item; admins may delete any variant
+// @Tags         variants
+// @Produce      json
+// @Param        id         path      int  true  "Product ID" example(1)
+// @Param        variantId  path      int  true  "Variant ID" example(1)
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
+// @Success      200  {object}  map[string]string "message: variant deleted"
+// @Failure      400  {object}  map[string]string "error: Invalid ID format"
+// @Failure      403  {object}  map[string]string "error: forbidden, insufficient role, or missing/invalid CSRF token"
+// @Failure      404  {object}  map[string]string "error: item or variant not found"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /items/{id}/variants/{variantId} [delete]
+func (h *VariantHandler) Delete(c *fiber.Ctx) error {
+	user, ok := CurrentUser(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	itemID, id, ok := variantID(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "",
+			"error":   "Invalid ID format",
+		})
+	}
+
+	if err := h.uc.Delete(user.UserID, user.Role, itemID, id); err != nil {
+		return variantError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "variant deleted",
 		"error":   "",
 	})
 }
 
+// Upload godoc
+// @Summary      Upload product image
+// @Description  Store an image in MinIO and return its key for use as productImageKey. Requires the editor role
+// @Tags         images
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        image  formData  file  true  "Product image"
+// @Param        X-CSRF-Token header    string  false  "CSRF token from GET /csrf, required with cookie authentication"
+// @Success      200    {object}  map[string]string "message: products-images/177...jpg"
+// @Failure      400    {object}  map[string]string "error: Image is required"
+// @Failure      403    {object}  map[string]string "error: insufficient role, or missing/invalid CSRF token"
+// @Failure      500    {object}  map[string]string "error: Failed to process image file"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /image [post]
 func (h *ItemHandler) Upload(c *fiber.Ctx) error {
 	// 1. Get the file from the multipart form
 	fileHeader, err := c.FormFile("image")
@@ -360,6 +2398,17 @@ func (h *ItemHandler) Upload(c *fiber.Ctx) error {
 	})
 }
 
+// GetUpload godoc
+// @Summary      Download product image
+// @Description  Stream an uploaded image from MinIO by its key
+// @Tags         images
+// @Produce      octet-stream
+// @Param        key  path      string  true  "Image key, e.g. products-images/177...jpg"
+// @Success      200  {file}    binary
+// @Failure      404  {object}  map[string]string "error: File not found in MinIO"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /image/{key} [get]
 func (h *ItemHandler) GetUpload(c *fiber.Ctx) error {
 	// 1. Get the path after /images/
 	objectName := c.Params("*")
@@ -380,3 +2429,153 @@ func (h *ItemHandler) GetUpload(c *fiber.Ctx) error {
 	// 4. SendStream will handle closing the MinIO object automatically
 	return c.SendStream(file.Reader)
 }
+
+// clientInfo describes the requesting device for session listings.
+func clientInfo(c *fiber.Ctx) entities.ClientInfo {
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	return entities.ClientInfo{IP: c.IP(), UserAgent: userAgent}
+}
+
+func unauthorized(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"message": "",
+		"error":   "unauthorized",
+	})
+}
+
+// itemError maps item use case errors to their HTTP status.
+func itemError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	message := "internal error"
+	switch {
+	case errors.Is(err, entities.ErrItemNotFound),
+		errors.Is(err, entities.ErrVariantNotFound):
+		status = fiber.StatusNotFound
+		message = err.Error()
+	case errors.Is(err, entities.ErrItemForbidden):
+		status = fiber.StatusForbidden
+		message = err.Error()
+	case isItemInputError(err),
+		errors.Is(err, use_cases.ErrInvalidAdjustment),
+		errors.Is(err, use_cases.ErrInvalidPage):
+		status = fiber.StatusBadRequest
+		message = err.Error()
+	case errors.Is(err, entities.ErrInsufficientStock):
+		status = fiber.StatusConflict
+		message = err.Error()
+	default:
+		log.Printf("%s %s: %v", c.Method(), c.Path(), err)
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"message": "",
+		"error":   message,
+	})
+}
+
+// variantID parses the :variantId route parameter.
+func variantID(c *fiber.Ctx) (uint, uint, bool) {
+	itemID, err := c.ParamsInt("id")
+	if err != nil || itemID <= 0 {
+		return 0, 0, false
+	}
+	id, err := c.ParamsInt("variantId")
+	if err != nil || id <= 0 {
+		return 0, 0, false
+	}
+	return uint(itemID), uint(id), true
+}
+
+// variantError maps variant use case errors to their HTTP status.
+func variantError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	message := "internal error"
+	switch {
+	case errors.Is(err, use_cases.ErrInvalidVariant),
+		errors.Is(err, use_cases.ErrInvalidPrice),
+		errors.Is(err, use_cases.ErrInvalidCurrency),
+		errors.Is(err, use_cases.ErrInvalidStock):
+		status = fiber.StatusBadRequest
+		message = err.Error()
+	case errors.Is(err, entities.ErrItemForbidden):
+		status = fiber.StatusForbidden
+		message = err.Error()
+	case errors.Is(err, entities.ErrItemNotFound),
+		errors.Is(err, entities.ErrVariantNotFound):
+		status = fiber.StatusNotFound
+		message = err.Error()
+	case errors.Is(err, entities.ErrSKUTaken),
+		errors.Is(err, use_cases.ErrDuplicateVariant):
+		status = fiber.StatusConflict
+		message = err.Error()
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"message": "",
+		"error":   message,
+	})
+}
+
+// isItemInputError reports whether err rejects the attributes given for an
+// item.
+func isItemInputError(err error) bool {
+	return errors.Is(err, entities.ErrCategoryNotFound) ||
+		errors.Is(err, use_cases.ErrInvalidTags) ||
+		errors.Is(err, use_cases.ErrInvalidPrice) ||
+		errors.Is(err, use_cases.ErrInvalidCurrency) ||
+		errors.Is(err, use_cases.ErrInvalidStock)
+}
+
+// mfaError maps MFA use case errors to their HTTP status.
+func mfaError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	message := "internal error"
+	switch {
+	case errors.Is(err, use_cases.ErrInvalidMFACode),
+		errors.Is(err, use_cases.ErrMFANotEnrolled):
+		status = fiber.StatusBadRequest
+		message = err.Error()
+	case errors.Is(err, use_cases.ErrMFAAlreadyEnabled):
+		status = fiber.StatusConflict
+		message = err.Error()
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"message": "",
+		"error":   message,
+	})
+}
+
+// oidcError maps OIDC sign-in errors to their HTTP status.
+func oidcError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	message := "internal error"
+	switch {
+	case errors.Is(err, use_cases.ErrUnknownProvider):
+		status = fiber.StatusNotFound
+		message = err.Error()
+	case errors.Is(err, use_cases.ErrInvalidOIDCState),
+		errors.Is(err, use_cases.ErrInvalidEmail):
+		status = fiber.StatusBadRequest
+		message = err.Error()
+	case errors.Is(err, use_cases.ErrOIDCEmailNotVerified):
+		status = fiber.StatusForbidden
+		message = err.Error()
+	case errors.Is(err, use_cases.ErrOIDCLinkUnverified),
+		errors.Is(err, entities.ErrEmailTaken):
+		status = fiber.StatusConflict
+		message = err.Error()
+	case errors.Is(err, use_cases.ErrIdentityProvider):
+		log.Printf("oidc: %v", err)
+		status = fiber.StatusBadGateway
+		message = use_cases.ErrIdentityProvider.Error()
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"message": "fail to login",
+		"error":   message,
+	})
+}
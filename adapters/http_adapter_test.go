@@ -0,0 +1,96 @@
+package adapters
+
+import (
+	"encoding/json"
+	"errors"
+	"hole/entities"
+	"hole/use_cases"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestItemUpdateRejectsBadBodies(t *testing.T) {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals(principalKey, &entities.Principal{UserID: 1, Role: entities.RoleEditor})
+		return c.Next()
+	})
+	// Both requests are refused before the use case is reached
+	app.Put("/items/:id", NewItemHandler(use_cases.NewItemUseCase(nil, nil, nil, nil, nil)).Update)
+
+	tests := []struct {
+		name      string
+		body      string
+		wantError string
+	}{
+		{"malformed JSON", `{"productName":`, "invalid request body"},
+		{"stock", `{"productName":"Lamp","stock":5}`, "POST /items/{id}/inventory"},
+		{"zero stock", `{"stock":0}`, "POST /items/{id}/inventory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", "/items/1", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != fiber.StatusBadRequest {
+				t.Fatalf("status = %d, want 400", resp.StatusCode)
+			}
+
+			var body struct {
+				Error string `json:"error"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(body.Error, tt.wantError) {
+				t.Errorf("error = %q, want one containing %q", body.Error, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestItemErrorHidesInternalErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantError  string
+	}{
+		{"not found", entities.ErrItemNotFound, fiber.StatusNotFound, entities.ErrItemNotFound.Error()},
+		{"forbidden", entities.ErrItemForbidden, fiber.StatusForbidden, entities.ErrItemForbidden.Error()},
+		{"invalid input", use_cases.ErrInvalidPrice, fiber.StatusBadRequest, use_cases.ErrInvalidPrice.Error()},
+		{"insufficient stock", entities.ErrInsufficientStock, fiber.StatusConflict, entities.ErrInsufficientStock.Error()},
+		{"database", errors.New(`pq: duplicate key value violates unique constraint "items_pkey"`), fiber.StatusInternalServerError, "internal error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error { return itemError(c, tt.err) })
+			resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			var body struct {
+				Error string `json:"error"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error != tt.wantError {
+				t.Errorf("error = %q, want %q", body.Error, tt.wantError)
+			}
+		})
+	}
+}
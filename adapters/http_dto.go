@@ -1,5 +1,7 @@
 package adapters
 
+import "time"
+
 // --- Auth DTOs ---
 
 type AuthRequest struct {
@@ -12,16 +14,168 @@ type AuthResponse struct {
 	Error   string `json:"error" example:""`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token" example:"eyJhbGciOiJFZERTQSIsImtpZCI6ImtleS0xIn0..."`
+	RefreshToken string `json:"refresh_token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	TokenType    string `json:"token_type" example:"Bearer"`
+	ExpiresIn    int    `json:"expires_in" example:"900"`
+}
+
+type SessionResponse struct {
+	ID         uint      `json:"id" example:"42"`
+	UserAgent  string    `json:"userAgent" example:"Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0"`
+	IP         string    `json:"ip" example:"203.0.113.7"`
+	CreatedAt  time.Time `json:"createdAt" example:"2026-05-01T08:30:00Z"`
+	LastUsedAt time.Time `json:"lastUsedAt" example:"2026-05-03T17:10:00Z"`
+	ExpiresAt  time.Time `json:"expiresAt" example:"2026-05-10T17:10:00Z"`
+	Current    bool      `json:"current" example:"true"`
+}
+
+type CSRFResponse struct {
+	CSRFToken string `json:"csrf_token" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" example:"test@example.com"`
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email" example:"test@example.com"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" example:"q3Yd0m2..."`
+	Password string `json:"password" example:"n3w-Passw0rd"`
+}
+
+// --- MFA DTOs ---
+
+type MFAChallengeResponse struct {
+	MFARequired  bool   `json:"mfa_required" example:"true"`
+	MFAChallenge string `json:"mfa_challenge" example:"eyJhbGciOiJFZERTQSIsImtpZCI6ImtleS0xIn0..."`
+}
+
+type MFALoginRequest struct {
+	MFAChallenge string `json:"mfa_challenge" example:"eyJhbGciOiJFZERTQSIsImtpZCI6ImtleS0xIn0..."`
+	Code         string `json:"code" example:"123456"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" example:"123456"`
+}
+
+type TOTPEnrollResponse struct {
+	Secret     string `json:"secret" example:"JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+	OTPAuthURI string `json:"otpauth_uri" example:"otpauth://totp/Hole:test@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Hole"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes" example:"k3v9x2qa-7hd4m1zp"`
+}
+
+// --- Account DTOs ---
+
+type ProfileResponse struct {
+	ID          uint   `json:"id" example:"1"`
+	Email       string `json:"email" example:"test@example.com"`
+	DisplayName string `json:"displayName" example:"Test User"`
+	Verified    bool   `json:"verified" example:"true"`
+	Role        string `json:"role" example:"editor"`
+}
+
+type UpdateProfileRequest struct {
+	DisplayName *string `json:"displayName,omitempty" example:"Test User"`
+	Email       *string `json:"email,omitempty" example:"new@example.com"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" example:"password123"`
+	NewPassword     string `json:"newPassword" example:"n3w-Passw0rd"`
+}
+
+// --- API key DTOs ---
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" example:"ci-seeder"`
+	Scopes    []string   `json:"scopes" example:"items:read,items:write"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" example:"2027-01-01T00:00:00Z"`
+}
+
+type APIKeyResponse struct {
+	ID     uint   `json:"id" example:"1"`
+	Name   string `json:"name" example:"ci-seeder"`
+	Prefix string `json:"prefix" example:"3f9a1c2b7d4e"`
+	// Key is only returned once, when the key is created.
+	Key        string     `json:"key,omitempty" example:"hole_3f9a1c2b7d4e_5c0b..."`
+	Scopes     []string   `json:"scopes" example:"items:read,items:write"`
+	ExpiresAt  *time.Time `json:"expiresAt" example:"2027-01-01T00:00:00Z"`
+	LastUsedAt *time.Time `json:"lastUsedAt" example:"2026-06-01T08:30:00Z"`
+	CreatedAt  time.Time  `json:"createdAt" example:"2026-05-01T08:30:00Z"`
+}
+
+// --- Admin DTOs ---
+
+type AssignRoleRequest struct {
+	Role string `json:"role" example:"editor" enums:"viewer,editor,admin"`
+}
+
+type LockoutResponse struct {
+	Key         string    `json:"key" example:"account:test@example.com"`
+	Failures    int       `json:"failures" example:"5"`
+	LockedUntil time.Time `json:"lockedUntil" example:"2026-01-01T12:00:30Z"`
+}
+
 // --- Item DTOs ---
 
 type CreateItemRequest struct {
-	ProductName string `json:"productName" example:"iphone 71"`
-	ProductDesc string `json:"productDesc" example:"Latest model with 128GB storage"`
+	ProductName string   `json:"productName" example:"iphone 71"`
+	ProductDesc string   `json:"productDesc" example:"Latest model with 128GB storage"`
+	CategoryID  *uint    `json:"categoryId" example:"3"`
+	Tags        []string `json:"tags" example:"refurbished,5g"`
+	PriceMinor  *int64   `json:"priceMinor" example:"79900"`
+	Currency    string   `json:"currency" example:"USD"`
+	Stock       int      `json:"stock" example:"25"`
 }
 
 type UpdateItemRequest struct {
-	ProductName string `json:"productName" example:"iphone 71"`
-	ProductDesc string `json:"productDesc" example:"Updated model with 256GB storage"`
+	ProductName string   `json:"productName" example:"iphone 71"`
+	ProductDesc string   `json:"productDesc" example:"Updated model with 256GB storage"`
+	CategoryID  *uint    `json:"categoryId" example:"3"`
+	Tags        []string `json:"tags" example:"refurbished,5g"`
+	PriceMinor  *int64   `json:"priceMinor" example:"74900"`
+	Currency    string   `json:"currency" example:"USD"`
+}
+
+type InventoryAdjustmentRequest struct {
+	// VariantID selects a variant of the item instead of the item itself.
+	VariantID *uint `json:"variantId" example:"4"`
+	// Delta is added to the stock; negative values remove stock.
+	Delta  int    `json:"delta" example:"-2"`
+	Reason string `json:"reason" example:"sale" enums:"restock,sale,return,damage,correction"`
+	Note   string `json:"note" example:"order 1042"`
+}
+
+type VariantRequest struct {
+	SKU     string            `json:"sku" example:"IPH71-128-BLK"`
+	Options map[string]string `json:"options"`
+	// PriceMinor overrides the item price, in the currency of the item.
+	PriceMinor *int64 `json:"priceMinor" example:"84900"`
+	ImageKey   string `json:"imageKey" example:"products-images/1771234567.jpg"`
+	// Stock is the initial stock; it is ignored on update.
+	Stock int `json:"stock" example:"10"`
+}
+
+// --- Category DTOs ---
+
+type CategoryRequest struct {
+	Name string `json:"name" example:"Smartphones"`
+	// Slug is derived from the name when empty.
+	Slug     string `json:"slug" example:"smartphones"`
+	ParentID *uint  `json:"parentId" example:"1"`
 }
 
 type ItemResponse struct {
@@ -30,6 +184,15 @@ type ItemResponse struct {
 	ProductDesc string `json:"productDesc" example:"Latest model"`
 }
 
+// PageMeta accompanies paginated listings.
+type PageMeta struct {
+	Limit  int `json:"limit" example:"20"`
+	Offset int `json:"offset" example:"0"`
+	// NextCursor is empty on the last page.
+	NextCursor    string `json:"nextCursor" example:"eyJzIjoiaWQiLCJpZCI6MjB9"`
+	TotalEstimate int64  `json:"totalEstimate" example:"42"`
+}
+
 type ErrorResponse struct {
 	Error string `json:"error" example:"item not found"`
 }
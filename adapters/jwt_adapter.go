@@ -1,49 +1,119 @@
 package adapters
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
-	"os"
+	"hole/entities"
+	"hole/use_cases"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-type JWTService struct{}
+type JWTService struct {
+	keys          *KeyRing
+	refreshSecret []byte
+}
 
-var jwtKey = []byte("super-secret-key")
+const (
+	accessTokenType       = "access"
+	refreshTokenType      = "refresh"
+	mfaChallengeTokenType = "mfa_challenge"
+)
 
-func NewJWTService() *JWTService {
-	return &JWTService{}
+func NewJWTService(keys *KeyRing, refreshSecret string) *JWTService {
+	return &JWTService{keys: keys, refreshSecret: []byte(refreshSecret)}
 }
 
-func (j *JWTService) GenerateAccessToken(userID uint) (string, error) {
+func (j *JWTService) GenerateAccessToken(userID, tokenVersion uint, role entities.Role, sessionID string) (string, error) {
+	now := time.Now()
 	claims := jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(15 * time.Minute).Unix(),
-		"typ":     "access",
+		"ver":     tokenVersion,
+		"role":    string(role),
+		"sid":     sessionID,
+		"jti":     newTokenID(),
+		"iat":     now.Unix(),
+		"exp":     now.Add(use_cases.AccessTokenTTL).Unix(),
+		"typ":     accessTokenType,
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	key := j.keys.Current()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.Private)
 }
 
 func (j *JWTService) GenerateRefreshToken(userID uint) (string, error) {
+	now := time.Now()
 	claims := jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(7 * 24 * time.Hour).Unix(),
+		"jti":     newTokenID(),
+		"iat":     now.Unix(),
+		"exp":     now.Add(use_cases.RefreshTokenTTL).Unix(),
+		"typ":     refreshTokenType,
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	return token.SignedString([]byte(os.Getenv("JWT_REFRESH_SECRET")))
+	return token.SignedString(j.refreshSecret)
 }
 
 func (j *JWTService) ValidateAccessToken(tokenStr string) (jwt.MapClaims, error) {
+	return j.parse(tokenStr, accessTokenType)
+}
+
+// GenerateMFAChallenge issues the short-lived token that stands in for a
+// session between the password and second-factor steps of a login.
+func (j *JWTService) GenerateMFAChallenge(userID uint) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"jti":     newTokenID(),
+		"iat":     now.Unix(),
+		"exp":     now.Add(use_cases.MFAChallengeTTL).Unix(),
+		"typ":     mfaChallengeTokenType,
+	}
+
+	key := j.keys.Current()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.Private)
+}
+
+func (j *JWTService) ValidateMFAChallenge(tokenStr string) (uint, error) {
+	claims, err := j.parse(tokenStr, mfaChallengeTokenType)
+	if err != nil {
+		return 0, err
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok || userID <= 0 {
+		return 0, errors.New("invalid claims")
+	}
+	return uint(userID), nil
+}
+
+// parse verifies a token signed with the key ring and checks its type.
+func (j *JWTService) parse(tokenStr, typ string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := j.keys.Lookup(kid)
+		if !ok {
+			return nil, errors.New("unknown key id")
+		}
+		// The algorithm is bound to the key, never taken from the token alone
+		if t.Method.Alg() != key.Method.Alg() {
 			return nil, errors.New("unexpected signing method")
 		}
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
+		return key.Public, nil
+	},
+		jwt.WithValidMethods(j.keys.Algorithms()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
 
 	if err != nil || token == nil || !token.Valid {
 		return nil, errors.New("invalid token")
@@ -54,33 +124,23 @@ func (j *JWTService) ValidateAccessToken(tokenStr string) (jwt.MapClaims, error)
 		return nil, errors.New("invalid claims")
 	}
 
+	// A token of one type must never be accepted where another is expected,
+	// e.g. a refresh token or MFA challenge in place of an access token.
+	if claimed, _ := claims["typ"].(string); claimed != typ {
+		return nil, errors.New("invalid token type")
+	}
+
 	return claims, nil
 }
 
-// func ParseToken(tokenStr string) (jwt.MapClaims, error) {
-// 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-// 		return jwtKey, nil
-// 	})
-
-// 	if err != nil || !token.Valid {
-// 		return nil, err
-// 	}
-
-// 	return token.Claims.(jwt.MapClaims), nil
-// }
-
-// func Protected(c *fiber.Ctx) error {
-// 	auth := c.Cookies("auth_token")
-
-// 	if auth == "" {
-// 		return c.SendStatus(fiber.StatusUnauthorized)
-// 	}
-
-// 	claims, err := h.uc.ValidateAccessToken(auth)
+// JWKS returns the public verification keys for /.well-known/jwks.json.
+func (j *JWTService) JWKS() JWKSet {
+	return j.keys.JWKS()
+}
 
-// 	if err != nil {
-// 		return c.SendStatus(fiber.StatusUnauthorized)
-// 	}
-// 	c.Locals("user_id", claims["user_id"])
-// 	return c.Next()
-// }
+// newTokenID returns a random identifier used as the jti claim.
+func newTokenID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
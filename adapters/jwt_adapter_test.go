@@ -0,0 +1,328 @@
+package adapters
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"hole/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testSecret        = "test-secret-test-secret-test-secret"
+	testRefreshSecret = "test-refresh-secret-test-refresh-secret"
+)
+
+// writePEM stores a key as a PEM file and returns its path.
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func rsaKeyFile(t *testing.T) (string, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, "rsa.pem", "PRIVATE KEY", der), key
+}
+
+func ed25519KeyFile(t *testing.T) (string, string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, "ed.pem", "PRIVATE KEY", privDER), writePEM(t, "ed.pub.pem", "PUBLIC KEY", pubDER)
+}
+
+func newTestKeyRing(t *testing.T, cfg config.JWTConfig) *KeyRing {
+	t.Helper()
+	ring, err := NewKeyRing(cfg)
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+	return ring
+}
+
+// sign issues a token with arbitrary claims under a key of the ring.
+func sign(t *testing.T, key *SigningKey, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	s, err := token.SignedString(key.Private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func accessClaims(exp time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"user_id": 7,
+		"ver":     1,
+		"role":    "editor",
+		"iat":     time.Now().Add(-time.Minute).Unix(),
+		"exp":     exp.Unix(),
+		"typ":     accessTokenType,
+	}
+}
+
+func TestJWTServiceValidateAccessToken(t *testing.T) {
+	rsaPath, rsaKey := rsaKeyFile(t)
+	ring := newTestKeyRing(t, config.JWTConfig{
+		Secret:       testSecret,
+		CurrentKeyID: "rsa-1",
+		Keys:         []config.JWTKeySpec{{ID: "rsa-1", Algorithm: "RS256", Path: rsaPath}},
+	})
+	svc := NewJWTService(ring, testRefreshSecret)
+	current := ring.Current()
+	legacy, _ := ring.Lookup("")
+
+	valid, err := svc.GenerateAccessToken(7, 1, "editor", "family")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresh, err := svc.GenerateRefreshToken(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := svc.GenerateMFAChallenge(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The RSA public key used as an HMAC secret: the classic algorithm
+	// confusion attack against verifiers that trust the alg header
+	pubDER, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims(time.Now().Add(time.Hour)))
+	confused.Header["kid"] = current.ID
+	confusedToken, _ := confused.SignedString(pubPEM)
+
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, accessClaims(time.Now().Add(time.Hour)))
+	none.Header["kid"] = current.ID
+	noneToken, _ := none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	parts := strings.Split(valid, ".")
+	tamperedClaims := sign(t, current, accessClaims(time.Now().Add(time.Hour)))
+	tampered := parts[0] + "." + strings.Split(tamperedClaims, ".")[1] + "." + parts[2]
+
+	noExp := accessClaims(time.Now())
+	delete(noExp, "exp")
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid", valid, false},
+		{"legacy HS256 without kid", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims(time.Now().Add(time.Hour)))
+			s, _ := token.SignedString(legacy.Private)
+			return s
+		}(), false},
+		{"expired", sign(t, current, accessClaims(time.Now().Add(-time.Second))), true},
+		{"missing exp", sign(t, current, noExp), true},
+		{"tampered payload", tampered, true},
+		{"tampered signature", valid[:len(valid)-4] + "AAAA", true},
+		{"refresh token", refresh, true},
+		{"mfa challenge", challenge, true},
+		{"wrong type claim", sign(t, current, func() jwt.MapClaims {
+			c := accessClaims(time.Now().Add(time.Hour))
+			c["typ"] = refreshTokenType
+			return c
+		}()), true},
+		{"HS256 signed with RSA public key", confusedToken, true},
+		{"alg none", noneToken, true},
+		{"unknown kid", func() string {
+			k := *current
+			k.ID = "rsa-unknown"
+			return sign(t, &k, accessClaims(time.Now().Add(time.Hour)))
+		}(), true},
+		{"garbage", "not.a.token", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := svc.ValidateAccessToken(tt.token)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got claims %v", claims)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if claims["user_id"].(float64) != 7 {
+				t.Fatalf("user_id = %v, want 7", claims["user_id"])
+			}
+		})
+	}
+}
+
+func TestJWTServiceMFAChallengeRejectsAccessToken(t *testing.T) {
+	ring := newTestKeyRing(t, config.JWTConfig{Secret: testSecret})
+	svc := NewJWTService(ring, testRefreshSecret)
+
+	access, _ := svc.GenerateAccessToken(7, 1, "viewer", "family")
+	if _, err := svc.ValidateMFAChallenge(access); err == nil {
+		t.Fatal("access token accepted as MFA challenge")
+	}
+
+	challenge, _ := svc.GenerateMFAChallenge(7)
+	userID, err := svc.ValidateMFAChallenge(challenge)
+	if err != nil || userID != 7 {
+		t.Fatalf("ValidateMFAChallenge = %d, %v", userID, err)
+	}
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	rsaPath, _ := rsaKeyFile(t)
+	edPath, edPubPath := ed25519KeyFile(t)
+
+	oldRing := newTestKeyRing(t, config.JWTConfig{
+		Secret:       testSecret,
+		CurrentKeyID: "rsa-1",
+		Keys:         []config.JWTKeySpec{{ID: "rsa-1", Algorithm: "RS256", Path: rsaPath}},
+	})
+	oldToken, err := NewJWTService(oldRing, testRefreshSecret).GenerateAccessToken(7, 1, "viewer", "family")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyToken, err := NewJWTService(newTestKeyRing(t, config.JWTConfig{Secret: testSecret}), testRefreshSecret).
+		GenerateAccessToken(7, 1, "viewer", "family")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  config.JWTConfig
+		// Whether tokens signed by the old rsa-1 key and by the legacy
+		// secret still verify
+		oldValid, legacyValid bool
+		wantKid               string
+	}{
+		{
+			name: "new current key, old key kept for verification",
+			cfg: config.JWTConfig{
+				Secret:       testSecret,
+				CurrentKeyID: "ed-2",
+				Keys: []config.JWTKeySpec{
+					{ID: "rsa-1", Algorithm: "RS256", Path: rsaPath},
+					{ID: "ed-2", Algorithm: "EdDSA", Path: edPath},
+				},
+			},
+			oldValid: true, legacyValid: true, wantKid: "ed-2",
+		},
+		{
+			name: "old key retired",
+			cfg: config.JWTConfig{
+				Secret:       testSecret,
+				CurrentKeyID: "ed-2",
+				Keys:         []config.JWTKeySpec{{ID: "ed-2", Algorithm: "EdDSA", Path: edPath}},
+			},
+			oldValid: false, legacyValid: true, wantKid: "ed-2",
+		},
+		{
+			name: "legacy secret removed",
+			cfg: config.JWTConfig{
+				CurrentKeyID: "ed-2",
+				Keys: []config.JWTKeySpec{
+					{ID: "rsa-1", Algorithm: "RS256", Path: rsaPath},
+					{ID: "ed-2", Algorithm: "EdDSA", Path: edPath},
+				},
+			},
+			oldValid: true, legacyValid: false, wantKid: "ed-2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ring := newTestKeyRing(t, tt.cfg)
+			svc := NewJWTService(ring, testRefreshSecret)
+
+			if _, err := svc.ValidateAccessToken(oldToken); (err == nil) != tt.oldValid {
+				t.Errorf("old token valid = %v, want %v", err == nil, tt.oldValid)
+			}
+			if _, err := svc.ValidateAccessToken(legacyToken); (err == nil) != tt.legacyValid {
+				t.Errorf("legacy token valid = %v, want %v", err == nil, tt.legacyValid)
+			}
+
+			fresh, err := svc.GenerateAccessToken(7, 1, "viewer", "family")
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, _, err := jwt.NewParser().ParseUnverified(fresh, jwt.MapClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kid := parsed.Header["kid"]; kid != tt.wantKid {
+				t.Errorf("new tokens signed with kid %v, want %s", kid, tt.wantKid)
+			}
+			if _, err := svc.ValidateAccessToken(fresh); err != nil {
+				t.Errorf("fresh token rejected: %v", err)
+			}
+		})
+	}
+
+	t.Run("verification-only key cannot sign", func(t *testing.T) {
+		_, err := NewKeyRing(config.JWTConfig{
+			CurrentKeyID: "ed-pub",
+			Keys:         []config.JWTKeySpec{{ID: "ed-pub", Algorithm: "EdDSA", Path: edPubPath}},
+		})
+		if err == nil {
+			t.Fatal("expected an error for a public-only current key")
+		}
+	})
+
+	t.Run("key type must match algorithm", func(t *testing.T) {
+		_, err := NewKeyRing(config.JWTConfig{
+			CurrentKeyID: "rsa-1",
+			Keys:         []config.JWTKeySpec{{ID: "rsa-1", Algorithm: "EdDSA", Path: rsaPath}},
+		})
+		if err == nil {
+			t.Fatal("expected an error for an RSA key configured as EdDSA")
+		}
+	})
+
+	t.Run("JWKS publishes only asymmetric keys", func(t *testing.T) {
+		ring := newTestKeyRing(t, tests[0].cfg)
+		set := ring.JWKS()
+		var kids []string
+		for _, key := range set.Keys {
+			kids = append(kids, key.Kid)
+		}
+		if strings.Join(kids, ",") != "ed-2,rsa-1" {
+			t.Fatalf("JWKS kids = %v, want [ed-2 rsa-1]", kids)
+		}
+	})
+}
@@ -0,0 +1,232 @@
+package adapters
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hole/config"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// legacyKeyID identifies the HS256 JWT_SECRET key, which is also used for
+// tokens issued before kid headers existed.
+const legacyKeyID = "hs256-legacy"
+
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	// Private is nil for verification-only keys.
+	Private interface{}
+	Public  interface{}
+}
+
+// KeyRing holds every key accepted for verification and the one used to sign.
+type KeyRing struct {
+	current string
+	keys    map[string]*SigningKey
+}
+
+func NewKeyRing(cfg config.JWTConfig) (*KeyRing, error) {
+	ring := &KeyRing{keys: map[string]*SigningKey{}}
+
+	if cfg.Secret != "" {
+		ring.keys[legacyKeyID] = &SigningKey{
+			ID:      legacyKeyID,
+			Method:  jwt.SigningMethodHS256,
+			Private: []byte(cfg.Secret),
+			Public:  []byte(cfg.Secret),
+		}
+		ring.current = legacyKeyID
+	}
+
+	for _, spec := range cfg.Keys {
+		key, err := loadSigningKey(spec)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %w", spec.ID, err)
+		}
+		ring.keys[key.ID] = key
+	}
+
+	if cfg.CurrentKeyID != "" {
+		ring.current = cfg.CurrentKeyID
+	}
+
+	current, ok := ring.keys[ring.current]
+	if !ok {
+		return nil, errors.New("no current signing key configured")
+	}
+	if current.Private == nil {
+		return nil, fmt.Errorf("current key %q has no private key", current.ID)
+	}
+
+	return ring, nil
+}
+
+func (k *KeyRing) Current() *SigningKey {
+	return k.keys[k.current]
+}
+
+// Lookup returns the verification key for a kid; an empty kid resolves to the
+// legacy HS256 key.
+func (k *KeyRing) Lookup(kid string) (*SigningKey, bool) {
+	if kid == "" {
+		kid = legacyKeyID
+	}
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// Algorithms lists the algorithms of all verification keys.
+func (k *KeyRing) Algorithms() []string {
+	seen := map[string]bool{}
+	var algs []string
+	for _, key := range k.keys {
+		alg := key.Method.Alg()
+		if !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS publishes the asymmetric verification keys; shared secrets are never
+// exposed.
+func (k *KeyRing) JWKS() JWKSet {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, id := range ids {
+		key := k.keys[id]
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Kid: key.ID,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Kid: key.ID,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return set
+}
+
+func loadSigningKey(spec config.JWTKeySpec) (*SigningKey, error) {
+	data, err := os.ReadFile(spec.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	key := &SigningKey{ID: spec.ID}
+	switch spec.Algorithm {
+	case jwt.SigningMethodRS256.Alg():
+		key.Method = jwt.SigningMethodRS256
+	case jwt.SigningMethodEdDSA.Alg():
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", spec.Algorithm)
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY", "RSA PRIVATE KEY":
+		private, err := parsePrivateKey(block)
+		if err != nil {
+			return nil, err
+		}
+		key.Private = private
+		key.Public = private.Public()
+	case "PUBLIC KEY", "RSA PUBLIC KEY":
+		public, err := parsePublicKey(block)
+		if err != nil {
+			return nil, err
+		}
+		key.Public = public
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+
+	switch key.Public.(type) {
+	case *rsa.PublicKey:
+		if key.Method != jwt.SigningMethodRS256 {
+			return nil, errors.New("RSA key configured for a non-RSA algorithm")
+		}
+	case ed25519.PublicKey:
+		if key.Method != jwt.SigningMethodEdDSA {
+			return nil, errors.New("Ed25519 key configured for a non-EdDSA algorithm")
+		}
+	default:
+		return nil, errors.New("unsupported key type")
+	}
+
+	return key, nil
+}
+
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	}
+	return nil, errors.New("unsupported private key type")
+}
+
+func parsePublicKey(block *pem.Block) (interface{}, error) {
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
@@ -1,48 +1,172 @@
 package adapters
 
 import (
+	"errors"
+	"hole/entities"
 	"hole/use_cases"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func Protected(ts use_cases.TokenService) fiber.Handler {
+const (
+	principalKey  = "principal"
+	authSourceKey = "auth_source"
+)
+
+const (
+	authSourceBearer = "bearer"
+	authSourceCookie = "cookie"
+	authSourceAPIKey = "api_key"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// ScopeRule grants API keys with Scope access to requests matching Pattern,
+// a "METHOD /path" pattern as used by RequireVerified.
+type ScopeRule struct {
+	Pattern string
+	Scope   string
+}
+
+func Protected(auth *use_cases.AuthUseCase, apiKeys *use_cases.APIKeyUseCase) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// 1. Get token from cookie
-		auth := c.Cookies("auth_token")
-		if auth == "" {
+		// Machine clients authenticate with an API key instead of a token
+		if key := c.Get(apiKeyHeader); key != "" {
+			principal, err := apiKeys.Authenticate(key)
+			if err != nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Invalid or expired API key",
+				})
+			}
+			c.Locals(principalKey, principal)
+			c.Locals(authSourceKey, authSourceAPIKey)
+			return c.Next()
+		}
+
+		// 1. Get token from the Authorization header, falling back to the cookie
+		token, source := accessTokenFrom(c)
+		if token == "" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Missing authentication token",
 			})
 		}
 
-		// // 2. Validate using the injected service
-		// claims, err := ts.ValidateAccessToken(auth)
-		// if err != nil {
-		// 	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-		// 		"error": "Invalid or expired token",
-		// 	})
-		// }
-
-		// // 3. Extract and convert user_id to uuid.UUID
-		// // JWT claims often store values as strings or float64
-		// userIDStr, ok := claims["user_id"].(string)
-		// if !ok {
-		// 	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-		// 		"error": "Invalid token payload",
-		// 	})
-		// }
-
-		// userUID, err := uuid.Parse(userIDStr)
-		// if err != nil {
-		// 	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-		// 		"error": "Invalid user identification",
-		// 	})
-		// }
-
-		// 4. Set as actual UUID type for handlers to use
-		// c.Locals("user_id", userUID)
+		// 2. Validate signature, expiry, token type and token version
+		principal, err := auth.Authenticate(token)
+		if errors.Is(err, use_cases.ErrSessionRevoked) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Session has been revoked",
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid or expired token",
+			})
+		}
+
+		// 3. Make the caller available to handlers through CurrentUser
+		c.Locals(principalKey, principal)
+		c.Locals(authSourceKey, source)
+
+		return c.Next()
+	}
+}
+
+// RequireVerified rejects users who have not verified their email unless the
+// request matches one of the allowed "METHOD /path" patterns, where a trailing
+// * matches any suffix. It must run after Protected.
+func RequireVerified(allowed []string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := CurrentUser(c)
+		if !ok || principal.Verified {
+			return c.Next()
+		}
+
+		route := c.Method() + " " + c.Path()
+		for _, pattern := range allowed {
+			if routeMatches(route, pattern) {
+				return c.Next()
+			}
+		}
+
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "",
+			"error":   "email address not verified",
+		})
+	}
+}
 
+// RequireAPIKeyScope limits API keys to the routes covered by a rule whose
+// scope the key was granted; every other route is closed to them. Session
+// tokens are not affected. It must run after Protected.
+func RequireAPIKeyScope(rules []ScopeRule) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := CurrentUser(c)
+		if !ok || principal.APIKeyID == 0 {
+			return c.Next()
+		}
+
+		route := c.Method() + " " + c.Path()
+		for _, rule := range rules {
+			if routeMatches(route, rule.Pattern) && principal.Allows(rule.Scope) {
+				return c.Next()
+			}
+		}
+
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "",
+			"error":   "api key does not grant access to this route",
+		})
+	}
+}
+
+// RequireRole rejects callers whose role does not include the given one. It
+// must run after Protected.
+func RequireRole(role entities.Role) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := CurrentUser(c)
+		if !ok {
+			return unauthorized(c)
+		}
+		if !principal.Role.Includes(role) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "",
+				"error":   "insufficient role",
+			})
+		}
 		return c.Next()
 	}
 }
+
+// CurrentUser returns the principal stored by Protected.
+func CurrentUser(c *fiber.Ctx) (*entities.Principal, bool) {
+	principal, ok := c.Locals(principalKey).(*entities.Principal)
+	return principal, ok && principal != nil
+}
+
+// routeMatches reports whether a "METHOD /path" route matches a pattern,
+// where a trailing * matches any suffix.
+func routeMatches(route, pattern string) bool {
+	if prefix, wildcard := strings.CutSuffix(pattern, "*"); wildcard {
+		return strings.HasPrefix(route, prefix)
+	}
+	return route == pattern
+}
+
+// accessTokenFrom prefers an explicit "Authorization: Bearer" header over the
+// auth_token cookie so that API clients are never shadowed by a stale cookie.
+func accessTokenFrom(c *fiber.Ctx) (string, string) {
+	scheme, token, found := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+	if found && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token), authSourceBearer
+	}
+	return c.Cookies("auth_token"), authSourceCookie
+}
+
+// authenticatedByCookie reports whether Protected accepted the request on the
+// strength of the auth_token cookie.
+func authenticatedByCookie(c *fiber.Ctx) bool {
+	source, _ := c.Locals(authSourceKey).(string)
+	return source == authSourceCookie
+}
@@ -0,0 +1,361 @@
+package adapters
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"hole/config"
+	"hole/use_cases"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID    = "hole-client"
+	testRedirectURL = "https://hole.example.com/auth/oidc/mock/callback"
+	testNonce       = "nonce-1"
+)
+
+// mockOIDCProvider is an OpenID Connect provider serving discovery, JWKS and
+// token endpoints. Its token endpoint checks the PKCE verifier against the
+// challenge of the last authorization URL and returns an ID token with the
+// claims built by idClaims, signed by signer.
+type mockOIDCProvider struct {
+	server *httptest.Server
+
+	mu sync.Mutex
+	// issuer is advertised by discovery; the server URL when empty.
+	issuer      string
+	noEndpoints bool
+	published   *KeyRing
+	signer      *SigningKey
+	idToken     func(claims jwt.MapClaims) string
+	idClaims    func(claims jwt.MapClaims)
+	challenge   string
+	jwksFetches int
+}
+
+func newMockOIDCProvider(t *testing.T, keys *KeyRing, signer *SigningKey) *mockOIDCProvider {
+	t.Helper()
+	m := &mockOIDCProvider{published: keys, signer: signer}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		d := oidcDiscovery{Issuer: m.issuer}
+		if d.Issuer == "" {
+			d.Issuer = m.server.URL
+		}
+		if !m.noEndpoints {
+			d.AuthorizationEndpoint = m.server.URL + "/authorize"
+			d.TokenEndpoint = m.server.URL + "/token"
+			d.JWKSURI = m.server.URL + "/jwks"
+		}
+		json.NewEncoder(w).Encode(d)
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.jwksFetches++
+		json.NewEncoder(w).Encode(m.published.JWKS())
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("code") != "code-1" ||
+			r.PostFormValue("redirect_uri") != testRedirectURL ||
+			base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		claims := jwt.MapClaims{
+			"iss":            m.server.URL,
+			"aud":            testClientID,
+			"sub":            "subject-1",
+			"iat":            now.Unix(),
+			"exp":            now.Add(time.Hour).Unix(),
+			"nonce":          testNonce,
+			"email":          "ada@example.com",
+			"email_verified": true,
+			"name":           "Ada",
+		}
+		if m.idClaims != nil {
+			m.idClaims(claims)
+		}
+		var token string
+		if m.idToken != nil {
+			token = m.idToken(claims)
+		} else {
+			t := jwt.NewWithClaims(m.signer.Method, claims)
+			t.Header["kid"] = m.signer.ID
+			token, _ = t.SignedString(m.signer.Private)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": token})
+	})
+
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockOIDCProvider) set(f func(m *mockOIDCProvider)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f(m)
+}
+
+func (m *mockOIDCProvider) fetches() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.jwksFetches
+}
+
+func (m *mockOIDCProvider) provider() *OIDCProvider {
+	return NewOIDCProvider(config.OIDCProviderConfig{
+		Name:        "mock",
+		Issuer:      m.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+		Scopes:      []string{"openid", "email"},
+	})
+}
+
+// signIn walks through the authorization code flow: it builds the
+// authorization URL, lets the mock provider see its PKCE challenge as the
+// browser would deliver it, and exchanges the code with verifier.
+func signIn(t *testing.T, m *mockOIDCProvider, p *OIDCProvider, verifier, presented string) (*use_cases.ExternalIdentity, error) {
+	t.Helper()
+	sum := sha256.Sum256([]byte(verifier))
+	authURL, err := p.AuthCodeURL("state-1", testNonce, base64.RawURLEncoding.EncodeToString(sum[:]))
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.set(func(m *mockOIDCProvider) { m.challenge = u.Query().Get("code_challenge") })
+
+	return p.Exchange(context.Background(), "code-1", presented)
+}
+
+func newProviderKeys(t *testing.T) (*KeyRing, *SigningKey) {
+	t.Helper()
+	rsaPath, _ := rsaKeyFile(t)
+	return providerKeys(t, "idp-1", config.JWTKeySpec{ID: "idp-1", Algorithm: "RS256", Path: rsaPath})
+}
+
+// providerKeys builds the keys a provider publishes and the one it signs with.
+func providerKeys(t *testing.T, current string, keys ...config.JWTKeySpec) (*KeyRing, *SigningKey) {
+	t.Helper()
+	ring := newTestKeyRing(t, config.JWTConfig{CurrentKeyID: current, Keys: keys})
+	return ring, ring.Current()
+}
+
+func TestOIDCProviderAuthCodeURL(t *testing.T) {
+	keys, signer := newProviderKeys(t)
+	m := newMockOIDCProvider(t, keys, signer)
+
+	authURL, err := m.provider().AuthCodeURL("state-1", testNonce, "challenge-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authURL)
+	if u.Scheme+"://"+u.Host+u.Path != m.server.URL+"/authorize" {
+		t.Errorf("authorization endpoint = %s", authURL)
+	}
+	for key, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"scope":                 "openid email",
+		"state":                 "state-1",
+		"nonce":                 testNonce,
+		"code_challenge":        "challenge-1",
+		"code_challenge_method": "S256",
+	} {
+		if got := u.Query().Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestOIDCProviderDiscovery(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(m *mockOIDCProvider)
+		wantErr string
+	}{
+		{"valid", func(m *mockOIDCProvider) {}, ""},
+		{"trailing slash on issuer", func(m *mockOIDCProvider) { m.issuer = m.server.URL + "/" }, ""},
+		{"issuer mismatch", func(m *mockOIDCProvider) { m.issuer = "https://evil.example.com" }, "does not match"},
+		{"missing endpoints", func(m *mockOIDCProvider) { m.noEndpoints = true }, "missing endpoints"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, signer := newProviderKeys(t)
+			m := newMockOIDCProvider(t, keys, signer)
+			m.set(tt.setup)
+
+			_, err := m.provider().AuthCodeURL("state-1", testNonce, "challenge-1")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDCProviderExchange(t *testing.T) {
+	_, otherSigner := newProviderKeys(t)
+
+	tests := []struct {
+		name     string
+		claims   func(c jwt.MapClaims)
+		idToken  func(m *mockOIDCProvider, c jwt.MapClaims) string
+		verifier string
+		wantErr  bool
+	}{
+		{name: "valid"},
+		{name: "email_verified as string", claims: func(c jwt.MapClaims) { c["email_verified"] = "true" }},
+		{name: "wrong PKCE verifier", verifier: "another-verifier", wantErr: true},
+		{name: "wrong issuer", claims: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, wantErr: true},
+		{name: "wrong audience", claims: func(c jwt.MapClaims) { c["aud"] = "another-client" }, wantErr: true},
+		{name: "several audiences with our azp", claims: func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "another-client"}
+			c["azp"] = testClientID
+		}},
+		{name: "several audiences with another azp", claims: func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "another-client"}
+			c["azp"] = "another-client"
+		}, wantErr: true},
+		{name: "several audiences without azp", claims: func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "another-client"}
+		}, wantErr: true},
+		{name: "expired", claims: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, wantErr: true},
+		{name: "missing exp", claims: func(c jwt.MapClaims) { delete(c, "exp") }, wantErr: true},
+		{name: "missing subject", claims: func(c jwt.MapClaims) { delete(c, "sub") }, wantErr: true},
+		{name: "signed by an unpublished key", idToken: func(m *mockOIDCProvider, c jwt.MapClaims) string {
+			token := jwt.NewWithClaims(otherSigner.Method, c)
+			token.Header["kid"] = m.signer.ID
+			s, _ := token.SignedString(otherSigner.Private)
+			return s
+		}, wantErr: true},
+		{name: "symmetric algorithm", idToken: func(m *mockOIDCProvider, c jwt.MapClaims) string {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, c)
+			token.Header["kid"] = m.signer.ID
+			s, _ := token.SignedString([]byte(testClientID))
+			return s
+		}, wantErr: true},
+		{name: "no kid with a single published key", idToken: func(m *mockOIDCProvider, c jwt.MapClaims) string {
+			s, _ := jwt.NewWithClaims(m.signer.Method, c).SignedString(m.signer.Private)
+			return s
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, signer := newProviderKeys(t)
+			m := newMockOIDCProvider(t, keys, signer)
+			m.set(func(m *mockOIDCProvider) {
+				m.idClaims = tt.claims
+				if tt.idToken != nil {
+					m.idToken = func(c jwt.MapClaims) string { return tt.idToken(m, c) }
+				}
+			})
+
+			presented := tt.verifier
+			if presented == "" {
+				presented = "verifier-1"
+			}
+			identity, err := signIn(t, m, m.provider(), "verifier-1", presented)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", identity)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want := use_cases.ExternalIdentity{Subject: "subject-1", Email: "ada@example.com", EmailVerified: true, Name: "Ada", Nonce: testNonce}
+			if *identity != want {
+				t.Errorf("identity = %+v, want %+v", *identity, want)
+			}
+		})
+	}
+}
+
+func TestOIDCProviderKeyRotation(t *testing.T) {
+	rsaPath, _ := rsaKeyFile(t)
+	oldKey := config.JWTKeySpec{ID: "idp-1", Algorithm: "RS256", Path: rsaPath}
+	keys, signer := providerKeys(t, "idp-1", oldKey)
+	m := newMockOIDCProvider(t, keys, signer)
+	p := m.provider()
+
+	if _, err := signIn(t, m, p, "verifier-1", "verifier-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signIn(t, m, p, "verifier-1", "verifier-1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := m.fetches(); n != 1 {
+		t.Fatalf("JWKS fetched %d times for a known kid, want 1", n)
+	}
+
+	// The provider rotates to a new key, still publishing the old one
+	edPath, _ := ed25519KeyFile(t)
+	rotated, signer := providerKeys(t, "idp-2", oldKey, config.JWTKeySpec{ID: "idp-2", Algorithm: "EdDSA", Path: edPath})
+	m.set(func(m *mockOIDCProvider) { m.published, m.signer = rotated, signer })
+
+	// An unknown kid right after a fetch does not hammer the provider
+	if _, err := signIn(t, m, p, "verifier-1", "verifier-1"); err == nil {
+		t.Fatal("token with an unknown kid accepted before refetching")
+	}
+	if n := m.fetches(); n != 1 {
+		t.Fatalf("JWKS fetched %d times within the refetch interval, want 1", n)
+	}
+
+	p.mu.Lock()
+	p.keysFetched = time.Now().Add(-jwksRefetchInterval)
+	p.mu.Unlock()
+
+	if _, err := signIn(t, m, p, "verifier-1", "verifier-1"); err != nil {
+		t.Fatalf("token signed with the new key: %v", err)
+	}
+	if n := m.fetches(); n != 2 {
+		t.Fatalf("JWKS fetched %d times, want 2", n)
+	}
+
+	// With several published keys a token must name its key
+	m.set(func(m *mockOIDCProvider) {
+		m.idToken = func(c jwt.MapClaims) string {
+			s, _ := jwt.NewWithClaims(m.signer.Method, c).SignedString(m.signer.Private)
+			return s
+		}
+	})
+	if _, err := signIn(t, m, p, "verifier-1", "verifier-1"); err == nil {
+		t.Fatal("token without kid accepted with several published keys")
+	}
+}
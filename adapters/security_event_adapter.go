@@ -0,0 +1,24 @@
+package adapters
+
+import (
+	"hole/entities"
+	"log"
+	"time"
+)
+
+// SecurityEventLogger writes security events to the application log.
+type SecurityEventLogger struct{}
+
+func NewSecurityEventLogger() *SecurityEventLogger {
+	return &SecurityEventLogger{}
+}
+
+func (l *SecurityEventLogger) Publish(event entities.SecurityEvent) {
+	log.Printf("[security] type=%s user_id=%d family_id=%s at=%s: %s",
+		event.Type,
+		event.UserID,
+		event.FamilyID,
+		event.OccurredAt.Format(time.RFC3339),
+		event.Detail,
+	)
+}
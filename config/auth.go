@@ -0,0 +1,61 @@
+package config
+
+import (
+	"bufio"
+	"hole/use_cases"
+	"log"
+	"os"
+)
+
+// LoadPasswordRules overrides the given defaults with PASSWORD_* and
+// BCRYPT_COST when they are set.
+func LoadPasswordRules(rules use_cases.PasswordRules) use_cases.PasswordRules {
+	rules.MinLength = envInt("PASSWORD_MIN_LENGTH", rules.MinLength)
+	rules.RequireUpper = envBool("PASSWORD_REQUIRE_UPPER", rules.RequireUpper)
+	rules.RequireLower = envBool("PASSWORD_REQUIRE_LOWER", rules.RequireLower)
+	rules.RequireDigit = envBool("PASSWORD_REQUIRE_DIGIT", rules.RequireDigit)
+	rules.RequireSymbol = envBool("PASSWORD_REQUIRE_SYMBOL", rules.RequireSymbol)
+	rules.BcryptCost = envInt("BCRYPT_COST", rules.BcryptCost)
+	return rules
+}
+
+// LoadBreachedPasswords reads BREACHED_PASSWORDS_FILE, one password or SHA-1
+// hex digest per line. It returns nil when the variable is unset.
+func LoadBreachedPasswords() []string {
+	path := os.Getenv("BREACHED_PASSWORDS_FILE")
+	if path == "" {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("Failed to open breached password list: %v", err)
+	}
+	defer file.Close()
+
+	var passwords []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		passwords = append(passwords, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("Failed to read breached password list: %v", err)
+	}
+
+	return passwords
+}
+
+// LoadMFAIssuer reads MFA_ISSUER, the name authenticator apps show next to
+// the account.
+func LoadMFAIssuer() string {
+	if issuer := os.Getenv("MFA_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "Hole"
+}
+
+// LoadAdminEmails reads ADMIN_EMAILS, a comma separated list of accounts that
+// are promoted to admin on startup so that a fresh install has an admin.
+func LoadAdminEmails() []string {
+	return envList("ADMIN_EMAILS", nil)
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// JWTKeySpec describes one access token key loaded from a PEM file. A file
+// holding only a public key makes the key verification-only.
+type JWTKeySpec struct {
+	ID        string
+	Algorithm string
+	Path      string
+}
+
+type JWTConfig struct {
+	// Secret is the legacy HS256 secret; tokens without a kid header are
+	// verified against it.
+	Secret        string
+	RefreshSecret string
+	CurrentKeyID  string
+	Keys          []JWTKeySpec
+}
+
+// LoadJWTConfig reads JWT_KEYS in the form
+// "kid1=RS256:/keys/kid1.pem;kid2=EdDSA:/keys/kid2.pem" and signs with
+// JWT_CURRENT_KID, falling back to the JWT_SECRET HS256 key.
+func LoadJWTConfig() JWTConfig {
+	cfg := JWTConfig{
+		Secret:        os.Getenv("JWT_SECRET"),
+		RefreshSecret: os.Getenv("JWT_REFRESH_SECRET"),
+		CurrentKeyID:  os.Getenv("JWT_CURRENT_KID"),
+	}
+
+	for _, entry := range strings.Split(os.Getenv("JWT_KEYS"), ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, rest, ok := strings.Cut(entry, "=")
+		if !ok {
+			log.Fatalf("Invalid JWT_KEYS entry: %q", entry)
+		}
+		alg, path, ok := strings.Cut(rest, ":")
+		if !ok {
+			log.Fatalf("Invalid JWT_KEYS entry: %q", entry)
+		}
+
+		cfg.Keys = append(cfg.Keys, JWTKeySpec{
+			ID:        strings.TrimSpace(id),
+			Algorithm: strings.TrimSpace(alg),
+			Path:      strings.TrimSpace(path),
+		})
+	}
+
+	return cfg
+}
+
+// minRefreshTokenHashKeyLen matches the output size of SHA-256, the hash of
+// the HMAC refresh tokens are stored as.
+const minRefreshTokenHashKeyLen = 32
+
+// LoadRefreshTokenHashKey reads REFRESH_TOKEN_HASH_KEY, the HMAC key refresh
+// tokens are hashed with before they are stored.
+func LoadRefreshTokenHashKey() []byte {
+	key := os.Getenv("REFRESH_TOKEN_HASH_KEY")
+	if len(key) < minRefreshTokenHashKeyLen {
+		log.Fatalf("REFRESH_TOKEN_HASH_KEY must be set to at least %d bytes", minRefreshTokenHashKeyLen)
+	}
+	return []byte(key)
+}
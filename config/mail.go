@@ -0,0 +1,112 @@
+package config
+
+import (
+	"hole/use_cases"
+	"log"
+	"os"
+	"time"
+)
+
+type MailConfig struct {
+	// Driver is "smtp", "log" or "memory".
+	Driver       string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	From         string
+	// LogFile receives messages from the log driver; stdout when empty.
+	LogFile string
+}
+
+// LoadMailConfig reads MAIL_DRIVER, which must be set: the log and memory
+// drivers do not deliver mail, and the log driver exposes the tokens in
+// verification, password reset and magic links to whoever reads its output.
+func LoadMailConfig() MailConfig {
+	cfg := MailConfig{
+		Driver:       os.Getenv("MAIL_DRIVER"),
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     envInt("SMTP_PORT", 587),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		From:         os.Getenv("MAIL_FROM"),
+		LogFile:      os.Getenv("MAIL_LOG_FILE"),
+	}
+	switch cfg.Driver {
+	case "":
+		log.Fatalf("MAIL_DRIVER must be set to smtp, log or memory")
+	case "log":
+		log.Printf("WARNING: MAIL_DRIVER=log writes every mail, including verification, password reset " +
+			"and magic link tokens, to the server output instead of sending it. Do not use it in production.")
+	case "memory":
+		log.Printf("WARNING: MAIL_DRIVER=memory keeps every mail in memory instead of sending it. " +
+			"Do not use it in production.")
+	}
+	if cfg.From == "" {
+		cfg.From = "no-reply@localhost"
+	}
+	return cfg
+}
+
+// LoadVerificationSettings reads APP_BASE_URL, VERIFICATION_TOKEN_TTL and
+// VERIFICATION_RESEND_INTERVAL.
+func LoadVerificationSettings() use_cases.VerificationSettings {
+	cfg := use_cases.VerificationSettings{
+		BaseURL:        os.Getenv("APP_BASE_URL"),
+		TokenTTL:       envDuration("VERIFICATION_TOKEN_TTL", 24*time.Hour),
+		ResendInterval: envDuration("VERIFICATION_RESEND_INTERVAL", time.Minute),
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = "http://localhost:8000"
+	}
+	return cfg
+}
+
+// LoadPasswordResetSettings reads PASSWORD_RESET_URL, PASSWORD_RESET_TOKEN_TTL
+// and PASSWORD_RESET_INTERVAL. PASSWORD_RESET_URL is required: it is the
+// frontend page that asks for the new password and posts it with the token
+// to POST /password/reset, which the API itself does not serve as a page.
+func LoadPasswordResetSettings() use_cases.PasswordResetSettings {
+	cfg := use_cases.PasswordResetSettings{
+		LinkURL:         os.Getenv("PASSWORD_RESET_URL"),
+		TokenTTL:        envDuration("PASSWORD_RESET_TOKEN_TTL", time.Hour),
+		RequestInterval: envDuration("PASSWORD_RESET_INTERVAL", time.Minute),
+	}
+	if cfg.LinkURL == "" {
+		log.Fatalf("PASSWORD_RESET_URL must be set to the frontend page that completes a password reset")
+	}
+	return cfg
+}
+
+// LoadMagicLinkSettings reads MAGIC_LINK_URL, MAGIC_LINK_TOKEN_TTL,
+// MAGIC_LINK_INTERVAL and MAGIC_LINK_BIND_BROWSER.
+func LoadMagicLinkSettings() use_cases.MagicLinkSettings {
+	cfg := use_cases.MagicLinkSettings{
+		LinkURL:         os.Getenv("MAGIC_LINK_URL"),
+		TokenTTL:        envDuration("MAGIC_LINK_TOKEN_TTL", 15*time.Minute),
+		RequestInterval: envDuration("MAGIC_LINK_INTERVAL", time.Minute),
+		BindBrowser:     envBool("MAGIC_LINK_BIND_BROWSER", true),
+	}
+	if cfg.LinkURL == "" {
+		baseURL := os.Getenv("APP_BASE_URL")
+		if baseURL == "" {
+			baseURL = "http://localhost:8000"
+		}
+		cfg.LinkURL = baseURL + "/login/magic"
+	}
+	return cfg
+}
+
+// LoadUnverifiedRoutes returns the "METHOD /path" patterns unverified users
+// may call, from UNVERIFIED_ALLOWED_ROUTES; a trailing * matches any suffix.
+func LoadUnverifiedRoutes() []string {
+	return envList("UNVERIFIED_ALLOWED_ROUTES", []string{
+		"GET /items*",
+		"GET /image/*",
+		"GET /categories*",
+		"POST /logout",
+		"POST /verify/resend",
+		"GET /me",
+		"PATCH /me",
+	})
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+type OIDCProviderConfig struct {
+	// Name identifies the provider in routes, e.g. /auth/oidc/google/login.
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+type OIDCConfig struct {
+	Providers []OIDCProviderConfig
+	// PostLoginURL is where the browser is sent after a successful sign-in.
+	PostLoginURL string
+}
+
+// LoadOIDCConfig reads OIDC_PROVIDERS, a comma separated list of provider
+// names, and for each name OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET,
+// _REDIRECT_URL and _SCOPES. OIDC_POST_LOGIN_URL defaults to APP_BASE_URL.
+func LoadOIDCConfig() OIDCConfig {
+	baseURL := os.Getenv("APP_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8000"
+	}
+
+	cfg := OIDCConfig{PostLoginURL: os.Getenv("OIDC_POST_LOGIN_URL")}
+	if cfg.PostLoginURL == "" {
+		cfg.PostLoginURL = baseURL + "/"
+	}
+
+	for _, name := range envList("OIDC_PROVIDERS", nil) {
+		name = strings.ToLower(name)
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		p := OIDCProviderConfig{
+			Name:         name,
+			Issuer:       strings.TrimSuffix(os.Getenv(prefix+"ISSUER"), "/"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       envList(prefix+"SCOPES", []string{"openid", "email", "profile"}),
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			log.Fatalf("%sISSUER and %sCLIENT_ID must be set", prefix, prefix)
+		}
+		if p.RedirectURL == "" {
+			p.RedirectURL = baseURL + "/auth/oidc/" + name + "/callback"
+		}
+
+		cfg.Providers = append(cfg.Providers, p)
+	}
+
+	return cfg
+}
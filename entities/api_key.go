@@ -0,0 +1,41 @@
+package entities
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	ScopeItemsRead   = "items:read"
+	ScopeItemsWrite  = "items:write"
+	ScopeImagesWrite = "images:write"
+)
+
+// APIKeyScopes lists every scope an API key may be granted.
+var APIKeyScopes = []string{ScopeItemsRead, ScopeItemsWrite, ScopeImagesWrite}
+
+// APIKey is a long-lived credential a user creates for scripts and CI.
+type APIKey struct {
+	ID     uint `gorm:"primaryKey"`
+	UserID uint `gorm:"index"`
+	Name   string
+	// Key is the raw key; it is only held in memory and never persisted.
+	Key string `gorm:"-"`
+	// Prefix is the public part of the key used to look it up.
+	Prefix  string `gorm:"uniqueIndex"`
+	KeyHash string
+	// Scopes is a space separated list of granted scopes.
+	Scopes     string
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+func (k *APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
@@ -0,0 +1,26 @@
+package entities
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Category is a node of the catalog tree; root categories have no parent.
+type Category struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ParentID  *uint     `gorm:"index" json:"parentId"`
+	Name      string    `gorm:"not null" json:"name"`
+	Slug      string    `gorm:"uniqueIndex;not null" json:"slug"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Tag is a free-form label shared by any number of items.
+type Tag struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"uniqueIndex;not null"`
+}
+
+// MarshalJSON renders a tag as its name.
+func (t Tag) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Name)
+}
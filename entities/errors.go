@@ -0,0 +1,20 @@
+package entities
+
+import "errors"
+
+var (
+	ErrItemNotFound      = errors.New("item not found")
+	ErrItemForbidden     = errors.New("forbidden")
+	ErrUserNotFound      = errors.New("user not found")
+	ErrEmailTaken        = errors.New("email already registered")
+	ErrInvalidToken      = errors.New("invalid or expired token")
+	ErrInvalidRole       = errors.New("invalid role")
+	ErrAPIKeyNotFound    = errors.New("api key not found")
+	ErrSessionNotFound   = errors.New("session not found")
+	ErrIdentityNotFound  = errors.New("identity not found")
+	ErrCategoryNotFound  = errors.New("category not found")
+	ErrSlugTaken         = errors.New("category slug already in use")
+	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrVariantNotFound   = errors.New("variant not found")
+	ErrSKUTaken          = errors.New("sku already in use")
+)
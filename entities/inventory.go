@@ -0,0 +1,43 @@
+package entities
+
+import "time"
+
+type InventoryReason string
+
+const (
+	InventoryRestock    InventoryReason = "restock"
+	InventorySale       InventoryReason = "sale"
+	InventoryReturn     InventoryReason = "return"
+	InventoryDamage     InventoryReason = "damage"
+	InventoryCorrection InventoryReason = "correction"
+	// InventoryInitial records the stock an item was created with; clients
+	// cannot use it.
+	InventoryInitial InventoryReason = "initial"
+)
+
+// Valid reports whether clients may adjust stock with this reason.
+func (r InventoryReason) Valid() bool {
+	switch r {
+	case InventoryRestock, InventorySale, InventoryReturn, InventoryDamage, InventoryCorrection:
+		return true
+	}
+	return false
+}
+
+// InventoryAdjustment is one entry of the stock ledger of an item and its
+// variants.
+type InventoryAdjustment struct {
+	ID     uint `gorm:"primaryKey" json:"id"`
+	ItemID uint `gorm:"index;not null" json:"itemId"`
+	// VariantID is set when the stock of a variant changed rather than
+	// that of the item itself.
+	VariantID *uint           `gorm:"index" json:"variantId,omitempty"`
+	Delta     int             `gorm:"not null" json:"delta"`
+	Reason    InventoryReason `gorm:"not null" json:"reason"`
+	Note      string          `json:"note"`
+	ActorID   uint            `gorm:"not null" json:"actorId"`
+	// StockAfter is the stock of the item, or of the variant, once the
+	// adjustment was applied.
+	StockAfter int       `gorm:"not null" json:"stockAfter"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
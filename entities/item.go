@@ -1,12 +1,36 @@
 package entities
 
-import "io"
+import (
+	"io"
+	"time"
+)
 
 type Item struct {
-	ProductID       uint   `gorm:"primaryKey;column:product_id" json:"productId"`
-	ProductName     string `gorm:"index" json:"productName"`
-	ProductDesc     string `json:"productDesc"`
-	ProductImageKey string `json:"productImageKey"`
+	ProductID       uint      `gorm:"primaryKey;column:product_id" json:"productId"`
+	ProductName     string    `gorm:"index" json:"productName"`
+	ProductDesc     string    `json:"productDesc"`
+	ProductImageKey string    `json:"productImageKey"`
+	OwnerID         uint      `gorm:"index" json:"ownerId"`
+	CategoryID      *uint     `gorm:"index" json:"categoryId"`
+	Tags            []Tag     `gorm:"many2many:item_tags" json:"tags"`
+	Variants        []Variant `gorm:"constraint:OnDelete:CASCADE" json:"variants,omitempty"`
+	PriceMinor      int64     `gorm:"not null;default:0" json:"priceMinor"`                             // in minor units of Currency, e.g. cents
+	Currency        string    `gorm:"size:3;not null;default:''" json:"currency"`                       // ISO 4217; empty when unpriced
+	Stock           int       `gorm:"not null;default:0;check:chk_items_stock,stock >= 0" json:"stock"` // changed only by inventory adjustments
+	CreatedAt       time.Time `gorm:"index;not null;default:CURRENT_TIMESTAMP" json:"createdAt"`
+}
+
+// ItemUpdate lists changes to an item; empty fields and nil pointers are
+// left unchanged. A CategoryID of 0 removes the category and empty non-nil
+// Tags remove all tags.
+type ItemUpdate struct {
+	Name       string
+	Desc       string
+	ImageKey   string
+	CategoryID *uint
+	Tags       []Tag
+	PriceMinor *int64
+	Currency   string
 }
 
 type HoleInfo struct {
@@ -0,0 +1,45 @@
+package entities
+
+import "time"
+
+type ItemSortField string
+
+const (
+	ItemSortID      ItemSortField = "id"
+	ItemSortName    ItemSortField = "name"
+	ItemSortCreated ItemSortField = "created"
+)
+
+type ItemFilter struct {
+	// NamePrefix matches product names case-insensitively.
+	NamePrefix string
+	// OwnerID limits the results to one owner when non-zero.
+	OwnerID uint
+	// Category limits the results to the category with this slug and its
+	// descendants.
+	Category string
+	// Tags lists tag names that every result must carry.
+	Tags []string
+}
+
+// ItemQuery selects one page of items. Pages are addressed either by Offset
+// or, for stable scrolling through changing data, by After.
+type ItemQuery struct {
+	Filter ItemFilter
+	Sort   ItemSortField
+	Desc   bool
+	Limit  int
+	Offset int
+	// After continues a keyset scan past this position; ties on the sort
+	// field are broken by product ID.
+	After *ItemCursor
+	// IncludeVariants loads the variants of each item.
+	IncludeVariants bool
+}
+
+// ItemCursor is the position of the last item of a page.
+type ItemCursor struct {
+	ID        uint
+	Name      string
+	CreatedAt time.Time
+}
@@ -0,0 +1,34 @@
+package entities
+
+import (
+	"strings"
+	"unicode"
+)
+
+// ItemSearchQuery is a full-text search over item names and descriptions.
+// Every term must match; the last one also matches as a prefix when
+// Prefix is set, so partially typed words find results.
+type ItemSearchQuery struct {
+	Terms  []string
+	Prefix bool
+	Limit  int
+	Offset int
+	// IncludeVariants loads the variants of each hit.
+	IncludeVariants bool
+}
+
+// ItemSearchHit is an item matching a search, with its relevance and an
+// HTML snippet in which matching words are wrapped in <mark> tags.
+type ItemSearchHit struct {
+	Item
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// SearchTerms splits text into the lower-case words the search index
+// contains: runs of letters and digits.
+func SearchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
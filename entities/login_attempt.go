@@ -0,0 +1,15 @@
+package entities
+
+import "time"
+
+// LoginAttempt tracks consecutive failed logins for an account or client IP.
+type LoginAttempt struct {
+	Key         string `gorm:"primaryKey"`
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time `gorm:"index"`
+}
+
+func (a *LoginAttempt) Locked(now time.Time) bool {
+	return now.Before(a.LockedUntil)
+}
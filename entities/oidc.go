@@ -0,0 +1,28 @@
+package entities
+
+import "time"
+
+// OIDCState is a pending sign-in with an external identity provider, kept
+// between the redirect to the provider and its callback.
+type OIDCState struct {
+	ID uint `gorm:"primaryKey"`
+	// State is the raw state parameter; it is only held in memory.
+	State     string `gorm:"-"`
+	StateHash string `gorm:"uniqueIndex"`
+	Provider  string
+	Nonce     string
+	// CodeVerifier is the PKCE secret whose challenge was sent to the provider.
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// UserIdentity links a user to an account at an external identity provider.
+type UserIdentity struct {
+	ID       uint   `gorm:"primaryKey"`
+	UserID   uint   `gorm:"index"`
+	Provider string `gorm:"uniqueIndex:idx_user_identities_subject"`
+	Subject  string `gorm:"uniqueIndex:idx_user_identities_subject"`
+	// Email is the address the provider asserted when the link was made.
+	Email     string
+	CreatedAt time.Time
+}
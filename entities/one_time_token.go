@@ -0,0 +1,30 @@
+package entities
+
+import "time"
+
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposeResetPassword = "reset_password"
+	TokenPurposeChangeEmail   = "change_email"
+	TokenPurposeMagicLogin    = "magic_login"
+)
+
+// OneTimeToken is a single-use, expiring token delivered out of band, such as
+// an email verification link.
+type OneTimeToken struct {
+	ID      uint   `gorm:"primaryKey"`
+	UserID  uint   `gorm:"index"`
+	Purpose string `gorm:"index"`
+	// Token is the raw token; it is only held in memory and never persisted.
+	Token     string `gorm:"-"`
+	TokenHash string `gorm:"uniqueIndex"`
+	// Binding is a secret held by the browser that requested the token, which
+	// must be presented along with it; only its hash is stored.
+	Binding     string `gorm:"-"`
+	BindingHash string `gorm:"not null;default:''"`
+	// Email is the address the token was sent to.
+	Email     string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
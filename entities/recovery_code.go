@@ -0,0 +1,11 @@
+package entities
+
+import "time"
+
+// RecoveryCode is a single-use fallback for a lost TOTP device.
+type RecoveryCode struct {
+	ID       uint   `gorm:"primaryKey"`
+	UserID   uint   `gorm:"index"`
+	CodeHash string `gorm:"index"`
+	UsedAt   *time.Time
+}
@@ -0,0 +1,29 @@
+package entities
+
+// Role is the coarse permission level of a user. Each role includes the
+// permissions of the roles below it: admin > editor > viewer.
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleAdmin  Role = "admin"
+)
+
+var roleRank = map[Role]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+func (r Role) Valid() bool {
+	_, ok := roleRank[r]
+	return ok
+}
+
+// Includes reports whether r grants at least the permissions of other.
+// Unknown roles include nothing.
+func (r Role) Includes(other Role) bool {
+	rank, ok := roleRank[r]
+	return ok && rank >= roleRank[other]
+}
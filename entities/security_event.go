@@ -0,0 +1,16 @@
+package entities
+
+import "time"
+
+const (
+	SecurityEventRefreshTokenReuse = "refresh_token_reuse"
+	SecurityEventLoginLockout      = "login_lockout"
+)
+
+type SecurityEvent struct {
+	Type       string
+	UserID     uint
+	FamilyID   string
+	Detail     string
+	OccurredAt time.Time
+}
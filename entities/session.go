@@ -0,0 +1,25 @@
+package entities
+
+import "time"
+
+// ClientInfo describes the device a request came from.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// Session is a signed-in device: a refresh token family seen through its
+// currently active token.
+type Session struct {
+	// ID is the ID of the family's active refresh token.
+	ID        uint
+	FamilyID  string
+	UserAgent string
+	IP        string
+	// CreatedAt is when the family was started by a login.
+	CreatedAt time.Time
+	// LastUsedAt is when the session last refreshed its tokens.
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	Current    bool
+}
@@ -3,9 +3,51 @@ package entities
 import "time"
 
 type RefreshToken struct {
-	ID        uint `gorm:"primaryKey"`
-	UserID    uint
-	Token     string `gorm:"unique"`
+	ID     uint `gorm:"primaryKey"`
+	UserID uint
+	// Token is the raw token; it is only held in memory and never persisted.
+	Token       string `gorm:"-"`
+	TokenHash   string `gorm:"uniqueIndex"`
+	TokenPrefix string `gorm:"index"`
+	// FamilyID groups every token rotated from the same login.
+	FamilyID string `gorm:"index"`
+	// ParentID is the token this one was rotated from.
+	ParentID  *uint
 	Revoked   bool
+	Rotated   bool
 	ExpiresAt time.Time
+	// UserAgent and IP identify the client the token was issued to.
+	UserAgent string
+	IP        string
+	CreatedAt time.Time
+	// LastUsedAt is set when the token is exchanged for a new pair.
+	LastUsedAt *time.Time
+}
+
+// Principal is the authenticated caller extracted from a validated access token.
+type Principal struct {
+	UserID   uint
+	TokenID  string
+	IssuedAt time.Time
+	// SessionID is the refresh token family the access token belongs to.
+	SessionID string
+	Verified  bool
+	Role      Role
+	// APIKeyID and Scopes are set when the caller used an API key; Scopes
+	// is nil for session tokens, which are not limited by scope.
+	APIKeyID uint
+	Scopes   []string
+}
+
+// Allows reports whether the principal's credential grants the scope.
+func (p *Principal) Allows(scope string) bool {
+	if p.Scopes == nil {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
 }
@@ -1,7 +1,28 @@
 package entities
 
+import "time"
+
 type User struct {
-	ID       uint   `gorm:"primaryKey"`
-	Email    string `gorm:"unique"`
-	Password string
+	ID          uint   `gorm:"primaryKey"`
+	Email       string `gorm:"unique"`
+	Password    string
+	DisplayName string
+	// TokenVersion is embedded in access tokens; bumping it invalidates them all.
+	TokenVersion uint `gorm:"not null;default:0"`
+	VerifiedAt   *time.Time
+	Role         Role `gorm:"not null;default:viewer"`
+	// TOTPSecret is set on enrollment; TOTP is only enforced once
+	// TOTPEnabledAt is set by a confirmed code.
+	TOTPSecret    string
+	TOTPEnabledAt *time.Time
+	// TOTPLastStep is the last accepted time step, preventing code replay.
+	TOTPLastStep int64
+}
+
+func (u *User) Verified() bool {
+	return u.VerifiedAt != nil
+}
+
+func (u *User) MFAEnabled() bool {
+	return u.TOTPEnabledAt != nil
 }
@@ -0,0 +1,60 @@
+package entities
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Variant is a purchasable version of an item, such as one size and
+// color, with its own SKU and stock.
+type Variant struct {
+	ID      uint           `gorm:"primaryKey" json:"id"`
+	ItemID  uint           `gorm:"index;not null" json:"itemId"`
+	SKU     string         `gorm:"uniqueIndex;not null" json:"sku"`
+	Options VariantOptions `gorm:"type:jsonb;not null;default:'{}'" json:"options"`
+	// PriceMinor overrides the item price when set; the currency is always
+	// that of the item.
+	PriceMinor *int64    `json:"priceMinor"`
+	Stock      int       `gorm:"not null;default:0;check:chk_variants_stock,stock >= 0" json:"stock"` // changed only by inventory adjustments
+	ImageKey   string    `json:"imageKey"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// VariantOptions maps option names to values, e.g. {"size": "m"}.
+type VariantOptions map[string]string
+
+// Equal reports whether both hold the same options.
+func (o VariantOptions) Equal(other VariantOptions) bool {
+	if len(o) != len(other) {
+		return false
+	}
+	for name, value := range o {
+		if v, ok := other[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (o VariantOptions) Value() (driver.Value, error) {
+	if o == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(o)
+	return string(b), err
+}
+
+func (o *VariantOptions) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, o)
+	case string:
+		return json.Unmarshal([]byte(v), o)
+	case nil:
+		*o = nil
+		return nil
+	}
+	return errors.New("unsupported type for variant options")
+}
@@ -38,6 +38,12 @@ const (
 // @securityDefinitions.apikey BearerAuth
 // @in header
 // @name Authorization
+// @description Type "Bearer" followed by a space and the access token from POST /login?mode=token.
+
+// @securityDefinitions.apikey APIKeyAuth
+// @in header
+// @name X-API-Key
+// @description Personal API key from POST /api-keys, limited to its scopes.
 
 func main() {
 
@@ -69,17 +75,43 @@ func main() {
 	)
 
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: newLogger, // add Logger
+		Logger:         newLogger, // add Logger
+		TranslateError: true,      // map unique violations to gorm.ErrDuplicatedKey
 	})
 
 	if err != nil {
 		panic("failed to connect to database")
 	}
+	// Accounts that predate email verification are treated as verified
+	verificationIntroduced := db.Migrator().HasTable(&entities.User{}) &&
+		!db.Migrator().HasColumn(&entities.User{}, "VerifiedAt")
+	// Before roles every user could manage items, so they start as editors
+	rolesIntroduced := db.Migrator().HasTable(&entities.User{}) &&
+		!db.Migrator().HasColumn(&entities.User{}, "Role")
+
 	db.AutoMigrate(&entities.User{},
 		&entities.RefreshToken{},
 		&entities.Item{},
+		&entities.LoginAttempt{},
+		&entities.OneTimeToken{},
+		&entities.RecoveryCode{},
+		&entities.APIKey{},
+		&entities.OIDCState{},
+		&entities.UserIdentity{},
+		&entities.Category{},
+		&entities.Tag{},
+		&entities.InventoryAdjustment{},
+		&entities.Variant{},
 	)
 
+	refreshRepo := repository.NewRefreshTokenRepository(db, config.LoadRefreshTokenHashKey())
+	if err := refreshRepo.MigratePlaintextTokens(); err != nil {
+		panic("failed to migrate refresh tokens: " + err.Error())
+	}
+	if err := refreshRepo.BackfillCreatedAt(use_cases.RefreshTokenTTL); err != nil {
+		panic("failed to migrate refresh tokens: " + err.Error())
+	}
+
 	fmt.Println("Database migration completed!")
 
 	minioClient := config.ConnectMinio()
@@ -87,38 +119,213 @@ func main() {
 	fileRepo := repository.NewMinioRepo(minioClient, bucketName)
 
 	userRepo := repository.NewUserRepository(db)
-	refreshRepo := repository.NewRefreshTokenRepository(db)
+	if verificationIntroduced {
+		if err := userRepo.VerifyExisting(time.Now()); err != nil {
+			panic("failed to migrate existing users: " + err.Error())
+		}
+	}
+	if rolesIntroduced {
+		if err := userRepo.AssignRoleToAll(entities.RoleEditor); err != nil {
+			panic("failed to migrate existing users: " + err.Error())
+		}
+	}
+	if err := userRepo.PromoteAdmins(config.LoadAdminEmails()); err != nil {
+		panic("failed to promote admins: " + err.Error())
+	}
 	itemRepo := repository.NewItemRepository(db)
-	jwtService := adapters.NewJWTService()
+	itemSearchRepo := repository.NewItemSearchRepository(db)
+	if err := itemSearchRepo.Migrate(); err != nil {
+		panic("failed to migrate search index: " + err.Error())
+	}
+	jwtConfig := config.LoadJWTConfig()
+	keyRing, err := adapters.NewKeyRing(jwtConfig)
+	if err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+	jwtService := adapters.NewJWTService(keyRing, jwtConfig.RefreshSecret)
+	securityEvents := adapters.NewSecurityEventLogger()
+	loginThrottle := use_cases.NewLoginThrottle(
+		repository.NewLoginAttemptRepository(db),
+		use_cases.DefaultLockoutPolicy(),
+	)
+
+	passwordPolicy, err := use_cases.NewPasswordPolicy(
+		config.LoadPasswordRules(use_cases.DefaultPasswordRules()),
+		config.LoadBreachedPasswords(),
+	)
+	if err != nil {
+		log.Fatalf("Invalid password policy: %v", err)
+	}
+
+	mailer, err := adapters.NewMailer(config.LoadMailConfig())
+	if err != nil {
+		log.Fatalf("Failed to configure mailer: %v", err)
+	}
+
+	oneTimeTokenRepo := repository.NewOneTimeTokenRepository(db)
+
+	verificationUC := use_cases.NewVerificationUseCase(
+		userRepo,
+		oneTimeTokenRepo,
+		mailer,
+		config.LoadVerificationSettings(),
+	)
 
 	authUC := use_cases.NewAuthUseCase(
 		userRepo,
 		refreshRepo,
 		jwtService,
+		securityEvents,
+		loginThrottle,
+		passwordPolicy,
+		verificationUC,
 	)
 
+	passwordResetUC := use_cases.NewPasswordResetUseCase(
+		userRepo,
+		oneTimeTokenRepo,
+		mailer,
+		passwordPolicy,
+		authUC,
+		config.LoadPasswordResetSettings(),
+	)
+
+	accountUC := use_cases.NewAccountUseCase(
+		userRepo,
+		passwordPolicy,
+		verificationUC,
+		authUC,
+	)
+
+	mfaUC := use_cases.NewMFAUseCase(
+		userRepo,
+		repository.NewRecoveryCodeRepository(db),
+		jwtService,
+		authUC,
+		loginThrottle,
+		use_cases.SystemClock{},
+		config.LoadMFAIssuer(),
+	)
+
+	magicLinkUC := use_cases.NewMagicLinkUseCase(
+		userRepo,
+		oneTimeTokenRepo,
+		mailer,
+		authUC,
+		config.LoadMagicLinkSettings(),
+	)
+
+	oidcConfig := config.LoadOIDCConfig()
+	oidcUC := use_cases.NewOIDCUseCase(
+		adapters.NewIdentityProviders(oidcConfig),
+		repository.NewOIDCStateRepository(db),
+		repository.NewUserIdentityRepository(db),
+		userRepo,
+		authUC,
+	)
+
+	apiKeyUC := use_cases.NewAPIKeyUseCase(
+		repository.NewAPIKeyRepository(db),
+		userRepo,
+	)
+
+	adminUC := use_cases.NewAdminUseCase(
+		userRepo,
+		loginThrottle,
+	)
+
+	categoryRepo := repository.NewCategoryRepository(db)
+	categoryUC := use_cases.NewCategoryUseCase(categoryRepo)
+
 	itemUC := use_cases.NewItemUseCase(
 		itemRepo,
 		fileRepo,
+		itemSearchRepo,
+		categoryRepo,
+		repository.NewInventoryRepository(db),
+	)
+
+	variantUC := use_cases.NewVariantUseCase(
+		itemRepo,
+		repository.NewVariantRepository(db),
 	)
 
 	itemHandler := adapters.NewItemHandler(itemUC)
+	variantHandler := adapters.NewVariantHandler(variantUC)
 	authHandler := adapters.NewAuthHandler(authUC)
+	verificationHandler := adapters.NewVerificationHandler(verificationUC)
+	passwordResetHandler := adapters.NewPasswordResetHandler(passwordResetUC)
+	accountHandler := adapters.NewAccountHandler(accountUC)
+	mfaHandler := adapters.NewMFAHandler(mfaUC)
+	magicLinkHandler := adapters.NewMagicLinkHandler(magicLinkUC)
+	oidcHandler := adapters.NewOIDCHandler(oidcUC, oidcConfig.PostLoginURL)
+	apiKeyHandler := adapters.NewAPIKeyHandler(apiKeyUC)
+	adminHandler := adapters.NewAdminHandler(adminUC)
+	categoryHandler := adapters.NewCategoryHandler(categoryUC)
+	jwksHandler := adapters.NewJWKSHandler(jwtService)
+
+	registerRoutes(app, endpoints{
+		JWKS: jwksHandler.Get,
+
+		Register:         authHandler.Register,
+		Login:            authHandler.Login,
+		LoginMFA:         mfaHandler.CompleteLogin,
+		MagicLinkRequest: magicLinkHandler.Request,
+		MagicLinkLogin:   magicLinkHandler.Login,
+		OIDCLogin:        oidcHandler.Login,
+		OIDCCallback:     oidcHandler.Callback,
+		Refresh:          authHandler.Refresh,
+		CSRFToken:        adapters.CSRFToken,
+		Verify:           verificationHandler.Verify,
+		ForgotPassword:   passwordResetHandler.Forgot,
+		ResetPassword:    passwordResetHandler.Reset,
+
+		ResendVerification: verificationHandler.Resend,
+
+		Me:             accountHandler.Me,
+		UpdateMe:       accountHandler.UpdateMe,
+		ChangePassword: accountHandler.ChangePassword,
+
+		CreateAPIKey: apiKeyHandler.Create,
+		ListAPIKeys:  apiKeyHandler.List,
+		RevokeAPIKey: apiKeyHandler.Revoke,
+
+		EnrollTOTP:  mfaHandler.Enroll,
+		ConfirmTOTP: mfaHandler.Confirm,
+		DisableTOTP: mfaHandler.Disable,
+
+		UploadImage: itemHandler.Upload,
+		GetImage:    itemHandler.GetUpload,
 
-	app.Post("/register", authHandler.Register)
-	app.Post("/login", authHandler.Login)
+		CreateItem:      itemHandler.Create,
+		ListItems:       itemHandler.List,
+		MyItems:         itemHandler.Mine,
+		SearchItems:     itemHandler.Search,
+		UpdateItem:      itemHandler.Update,
+		DeleteItem:      itemHandler.Delete,
+		ItemInventory:   itemHandler.Inventory,
+		AdjustInventory: itemHandler.AdjustInventory,
+		ListVariants:    variantHandler.List,
+		GetVariant:      variantHandler.Get,
+		CreateVariant:   variantHandler.Create,
+		UpdateVariant:   variantHandler.Update,
+		DeleteVariant:   variantHandler.Delete,
 
-	app.Use(adapters.Protected(jwtService))
+		ListCategories: categoryHandler.List,
+		GetCategory:    categoryHandler.Get,
+		CreateCategory: categoryHandler.Create,
+		UpdateCategory: categoryHandler.Update,
+		DeleteCategory: categoryHandler.Delete,
 
-	app.Post("/image", itemHandler.Upload)
-	app.Get("/image/*", itemHandler.GetUpload)
+		AssignRole: adminHandler.AssignRole,
+		Lockouts:   adminHandler.Lockouts,
+		Unlock:     adminHandler.Unlock,
 
-	app.Post("/items", itemHandler.Create)
-	app.Get("/items", itemHandler.List)
-	app.Put("/items/:id", itemHandler.Update)
-	app.Delete("/items/:id", itemHandler.Delete)
+		Sessions:      authHandler.Sessions,
+		RevokeSession: authHandler.RevokeSession,
 
-	app.Post("/logout", authHandler.Logout)
+		Logout: authHandler.Logout,
+	}, adapters.Protected(authUC, apiKeyUC), config.LoadUnverifiedRoutes())
 
 	app.Listen(":8000")
 }
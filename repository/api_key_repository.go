@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"hole/entities"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKeyRepositoryPostgres stores SHA-256 hashes of API keys next to their
+// public prefix; the raw key never reaches the database.
+type APIKeyRepositoryPostgres struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyRepository(db *gorm.DB) *APIKeyRepositoryPostgres {
+	return &APIKeyRepositoryPostgres{db}
+}
+
+func (r *APIKeyRepositoryPostgres) Create(k *entities.APIKey) error {
+	row := &entities.APIKey{
+		UserID:    k.UserID,
+		Name:      k.Name,
+		Prefix:    k.Prefix,
+		KeyHash:   hashAPIKey(k.Key),
+		Scopes:    k.Scopes,
+		ExpiresAt: k.ExpiresAt,
+	}
+	if err := r.db.Create(row).Error; err != nil {
+		return err
+	}
+	k.ID = row.ID
+	k.KeyHash = row.KeyHash
+	k.CreatedAt = row.CreatedAt
+	return nil
+}
+
+// FindByKey looks a key up by its prefix and checks the full key against the
+// stored hash.
+func (r *APIKeyRepositoryPostgres) FindByKey(prefix, key string) (*entities.APIKey, error) {
+	var k entities.APIKey
+	if err := r.db.Where("prefix = ?", prefix).First(&k).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, entities.ErrAPIKeyNotFound
+		}
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashAPIKey(key)), []byte(k.KeyHash)) != 1 {
+		return nil, entities.ErrAPIKeyNotFound
+	}
+	return &k, nil
+}
+
+func (r *APIKeyRepositoryPostgres) ListByUser(userID uint) ([]*entities.APIKey, error) {
+	var keys []*entities.APIKey
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at DESC").
+		Find(&keys).Error
+	return keys, err
+}
+
+// Revoke revokes one of the user's keys; keys of other users are reported as
+// not found.
+func (r *APIKeyRepositoryPostgres) Revoke(id, userID uint, at time.Time) error {
+	result := r.db.Model(&entities.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", at)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return entities.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (r *APIKeyRepositoryPostgres) TouchLastUsed(id uint, at time.Time) error {
+	return r.db.Model(&entities.APIKey{}).
+		Where("id = ?", id).
+		Update("last_used_at", at).Error
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,10 +1,11 @@
 package repository
 
 import (
-	"fmt"
+	"errors"
 	"hole/entities"
+	"strings"
+	"time"
 
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
@@ -16,28 +17,162 @@ func NewUserRepository(db *gorm.DB) *UserRepositoryPostgres {
 	return &UserRepositoryPostgres{db}
 }
 
+// Create stores a user whose Password already holds the bcrypt hash and sets
+// the generated ID on user.
 func (r *UserRepositoryPostgres) Create(user *entities.User) error {
-	hash, _ := bcrypt.GenerateFromPassword([]byte(user.Password), 10)
-	fmt.Printf("hased password :%s", string(hash))
-
-	return r.db.Create(&entities.User{
-		Email:    user.Email,
-		Password: string(hash),
-	}).Error
+	u := entities.User{
+		Email:       user.Email,
+		Password:    user.Password,
+		DisplayName: user.DisplayName,
+		VerifiedAt:  user.VerifiedAt,
+	}
+	err := r.db.Create(&u).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return entities.ErrEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+	user.ID = u.ID
+	return nil
 }
 
 func (r *UserRepositoryPostgres) FindByEmail(email string) (*entities.User, error) {
 	var u entities.User
-	if err := r.db.Where("email = ?", email).First(&u).Error; err != nil {
+	// Rows created before emails were normalized may still be mixed case
+	if err := r.db.Where("LOWER(email) = LOWER(?)", email).First(&u).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, entities.ErrUserNotFound
+		}
 		return nil, err
 	}
-	return &entities.User{ID: u.ID, Email: u.Email, Password: u.Password}, nil
+	return &u, nil
 }
 
 func (r *UserRepositoryPostgres) FindByID(id uint) (*entities.User, error) {
 	var u entities.User
 	if err := r.db.First(&u, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, entities.ErrUserNotFound
+		}
 		return nil, err
 	}
-	return &entities.User{ID: u.ID, Email: u.Email}, nil
+	return &u, nil
+}
+
+func (r *UserRepositoryPostgres) IncrementTokenVersion(id uint) error {
+	return r.db.Model(&entities.User{}).
+		Where("id = ?", id).
+		Update("token_version", gorm.Expr("token_version + 1")).Error
+}
+
+func (r *UserRepositoryPostgres) MarkVerified(id uint, at time.Time) error {
+	return r.db.Model(&entities.User{}).
+		Where("id = ? AND verified_at IS NULL", id).
+		Update("verified_at", at).Error
+}
+
+func (r *UserRepositoryPostgres) UpdatePassword(id uint, hash string) error {
+	return r.db.Model(&entities.User{}).
+		Where("id = ?", id).
+		Update("password", hash).Error
+}
+
+func (r *UserRepositoryPostgres) UpdateDisplayName(id uint, name string) error {
+	return r.db.Model(&entities.User{}).
+		Where("id = ?", id).
+		Update("display_name", name).Error
+}
+
+// UpdateEmail switches the user to a confirmed new address.
+func (r *UserRepositoryPostgres) UpdateEmail(id uint, email string, verifiedAt time.Time) error {
+	err := r.db.Model(&entities.User{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"email": email, "verified_at": verifiedAt}).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return entities.ErrEmailTaken
+	}
+	return err
+}
+
+// UpdateRole changes the user's role and bumps the token version so that
+// access tokens carrying the old role claim stop being accepted.
+func (r *UserRepositoryPostgres) UpdateRole(id uint, role entities.Role) error {
+	result := r.db.Model(&entities.User{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"role":          role,
+			"token_version": gorm.Expr("token_version + 1"),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return entities.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *UserRepositoryPostgres) SetTOTPSecret(id uint, secret string) error {
+	return r.db.Model(&entities.User{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"totp_secret": secret, "totp_enabled_at": nil, "totp_last_step": 0}).Error
+}
+
+func (r *UserRepositoryPostgres) EnableTOTP(id uint, at time.Time) error {
+	return r.db.Model(&entities.User{}).
+		Where("id = ?", id).
+		Update("totp_enabled_at", at).Error
+}
+
+func (r *UserRepositoryPostgres) DisableTOTP(id uint) error {
+	return r.db.Model(&entities.User{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"totp_secret": "", "totp_enabled_at": nil, "totp_last_step": 0}).Error
+}
+
+// AdvanceTOTPStep records a used time step and reports false if that step or
+// a later one was already used.
+func (r *UserRepositoryPostgres) AdvanceTOTPStep(id uint, step int64) (bool, error) {
+	result := r.db.Model(&entities.User{}).
+		Where("id = ? AND totp_last_step < ?", id, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// VerifyExisting marks every unverified user as verified. It is run once when
+// email verification is introduced so that existing accounts keep working.
+func (r *UserRepositoryPostgres) VerifyExisting(at time.Time) error {
+	return r.db.Model(&entities.User{}).
+		Where("verified_at IS NULL").
+		Update("verified_at", at).Error
+}
+
+// AssignRoleToAll gives every user the role. It is run once when roles are
+// introduced so that existing accounts keep the access they had.
+func (r *UserRepositoryPostgres) AssignRoleToAll(role entities.Role) error {
+	return r.db.Model(&entities.User{}).
+		Where("1 = 1").
+		Update("role", role).Error
+}
+
+// PromoteAdmins makes the users with the given emails admins, bumping the
+// token version of those whose role actually changes.
+func (r *UserRepositoryPostgres) PromoteAdmins(emails []string) error {
+	if len(emails) == 0 {
+		return nil
+	}
+	lowered := make([]string, len(emails))
+	for i, email := range emails {
+		lowered[i] = strings.ToLower(email)
+	}
+	return r.db.Model(&entities.User{}).
+		Where("LOWER(email) IN ? AND role <> ?", lowered, entities.RoleAdmin).
+		Updates(map[string]interface{}{
+			"role":          entities.RoleAdmin,
+			"token_version": gorm.Expr("token_version + 1"),
+		}).Error
 }
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"errors"
+	"hole/entities"
+
+	"gorm.io/gorm"
+)
+
+type CategoryRepositoryPostgres struct {
+	db *gorm.DB
+}
+
+func NewCategoryRepository(db *gorm.DB) *CategoryRepositoryPostgres {
+	return &CategoryRepositoryPostgres{db}
+}
+
+func (r *CategoryRepositoryPostgres) Create(category *entities.Category) error {
+	err := r.db.Create(category).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return entities.ErrSlugTaken
+	}
+	return err
+}
+
+func (r *CategoryRepositoryPostgres) FindByID(id uint) (*entities.Category, error) {
+	var category entities.Category
+	err := r.db.First(&category, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, entities.ErrCategoryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (r *CategoryRepositoryPostgres) List() ([]*entities.Category, error) {
+	var categories []*entities.Category
+	err := r.db.Order("name, id").Find(&categories).Error
+	return categories, err
+}
+
+func (r *CategoryRepositoryPostgres) Update(category *entities.Category) error {
+	result := r.db.Model(&entities.Category{}).
+		Where("id = ?", category.ID).
+		Updates(map[string]interface{}{
+			"name":      category.Name,
+			"slug":      category.Slug,
+			"parent_id": category.ParentID,
+		})
+	if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+		return entities.ErrSlugTaken
+	}
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return entities.ErrCategoryNotFound
+	}
+	return nil
+}
+
+func (r *CategoryRepositoryPostgres) Delete(id uint) error {
+	result := r.db.Delete(&entities.Category{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return entities.ErrCategoryNotFound
+	}
+	return nil
+}
+
+// SubtreeIDs returns the IDs of a category and all of its descendants.
+func (r *CategoryRepositoryPostgres) SubtreeIDs(id uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.Raw(`WITH RECURSIVE subtree AS (
+			SELECT id FROM categories WHERE id = ?
+			UNION
+			SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+		)
+		SELECT id FROM subtree`, id).Scan(&ids).Error
+	return ids, err
+}
+
+// InUse reports whether a category has subcategories or items.
+func (r *CategoryRepositoryPostgres) InUse(id uint) (bool, error) {
+	var used bool
+	err := r.db.Raw(`SELECT EXISTS (SELECT 1 FROM categories WHERE parent_id = ?)
+		OR EXISTS (SELECT 1 FROM items WHERE category_id = ?)`, id, id).Scan(&used).Error
+	return used, err
+}
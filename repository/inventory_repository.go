@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"errors"
+	"hole/entities"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type InventoryRepositoryPostgres struct {
+	db *gorm.DB
+}
+
+func NewInventoryRepository(db *gorm.DB) *InventoryRepositoryPostgres {
+	return &InventoryRepositoryPostgres{db}
+}
+
+// Adjust changes the stock of an item, or of one of its variants when
+// adj.VariantID is set, by adj.Delta and records adj in the ledger, in one
+// transaction. The row stays locked until the commit, so concurrent
+// adjustments are applied one after another and each sees the stock left by
+// the previous one.
+func (r *InventoryRepositoryPostgres) Adjust(adj *entities.InventoryAdjustment) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var stock int
+		var err error
+		if adj.VariantID != nil {
+			stock, err = adjustStock(tx, &entities.Variant{}, "id = ? AND item_id = ?", adj.Delta, *adj.VariantID, adj.ItemID)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return entities.ErrVariantNotFound
+			}
+		} else {
+			stock, err = adjustStock(tx, &entities.Item{}, "product_id = ?", adj.Delta, adj.ItemID)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return entities.ErrItemNotFound
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		adj.StockAfter = stock
+		return tx.Create(adj).Error
+	})
+}
+
+// adjustStock locks the row of model selected by where, adds delta to its
+// stock and returns the new stock.
+func adjustStock(tx *gorm.DB, model interface{}, where string, delta int, args ...interface{}) (int, error) {
+	var current struct{ Stock int }
+	err := tx.Model(model).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("stock").
+		Where(where, args...).
+		Take(&current).Error
+	if err != nil {
+		return 0, err
+	}
+
+	stock := current.Stock + delta
+	if stock < 0 {
+		return 0, entities.ErrInsufficientStock
+	}
+
+	err = tx.Model(model).Where(where, args...).Update("stock", stock).Error
+	return stock, err
+}
+
+// History returns the latest adjustments of an item, newest first.
+func (r *InventoryRepositoryPostgres) History(itemID uint, limit int) ([]*entities.InventoryAdjustment, error) {
+	var adjustments []*entities.InventoryAdjustment
+	err := r.db.Where("item_id = ?", itemID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&adjustments).Error
+	return adjustments, err
+}
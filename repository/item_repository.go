@@ -3,8 +3,10 @@ package repository
 import (
 	"errors"
 	"hole/entities"
+	"strings"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ItemRepositoryPostgres struct {
@@ -15,60 +17,223 @@ func NewItemRepository(db *gorm.DB) *ItemRepositoryPostgres {
 	return &ItemRepositoryPostgres{db}
 }
 
+// Create stores an item; its initial stock, if any, is recorded in the
+// inventory ledger.
 func (r *ItemRepositoryPostgres) Create(item *entities.Item) error {
-	return r.db.Create(item).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(item).Error; err != nil {
+			return err
+		}
+		if item.Stock == 0 {
+			return nil
+		}
+		return tx.Create(&entities.InventoryAdjustment{
+			ItemID:     item.ProductID,
+			Delta:      item.Stock,
+			Reason:     entities.InventoryInitial,
+			ActorID:    item.OwnerID,
+			StockAfter: item.Stock,
+		}).Error
+	})
 }
 
-func (r *ItemRepositoryPostgres) FindByIDAndOwner(id uint) (*entities.Item, error) {
+func (r *ItemRepositoryPostgres) FindByID(id uint) (*entities.Item, error) {
+	var item entities.Item
+	err := r.db.Where("product_id = ?", id).First(&item).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, entities.ErrItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (r *ItemRepositoryPostgres) FindByIDAndOwner(id, ownerID uint) (*entities.Item, error) {
 	var item entities.Item
 	err := r.db.
 		Where("product_id = ?", id).
 		First(&item).Error
 
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, entities.ErrItemNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
+
+	if item.OwnerID != ownerID {
+		return nil, entities.ErrItemForbidden
+	}
 	return &item, nil
 }
 
-func (r *ItemRepositoryPostgres) ListItem() ([]*entities.Item, error) {
+// ListPage returns up to q.Limit items matching the query.
+func (r *ItemRepositoryPostgres) ListPage(q entities.ItemQuery) ([]*entities.Item, error) {
+	column := itemSortColumn(q.Sort)
+	dir, cmp := "ASC", ">"
+	if q.Desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	tx := applyItemFilter(r.db.Model(&entities.Item{}), q.Filter)
+
+	if q.After != nil {
+		switch q.Sort {
+		case entities.ItemSortName:
+			tx = tx.Where("(product_name, product_id) "+cmp+" (?, ?)", q.After.Name, q.After.ID)
+		case entities.ItemSortCreated:
+			tx = tx.Where("(created_at, product_id) "+cmp+" (?, ?)", q.After.CreatedAt, q.After.ID)
+		default:
+			tx = tx.Where("product_id "+cmp+" ?", q.After.ID)
+		}
+	} else if q.Offset > 0 {
+		tx = tx.Offset(q.Offset)
+	}
+
+	if column != "product_id" {
+		tx = tx.Order(column + " " + dir)
+	}
+	if q.IncludeVariants {
+		tx = tx.Preload("Variants", func(db *gorm.DB) *gorm.DB { return db.Order("id") })
+	}
 	var items []*entities.Item
-	err := r.db.Find(&items).Error
+	err := tx.Order("product_id " + dir).Limit(q.Limit).Preload("Tags").Find(&items).Error
 	return items, err
 }
 
-func (r *ItemRepositoryPostgres) FindByOwnerID(ownerID uint) ([]*entities.Item, error) {
-	var items []*entities.Item
-	err := r.db.Where("owner_id = ?", ownerID).Find(&items).Error
-	return items, err
+// CountUpTo counts matching items, stopping at limit so that large tables
+// are never scanned in full.
+func (r *ItemRepositoryPostgres) CountUpTo(filter entities.ItemFilter, limit int) (int64, error) {
+	sub := applyItemFilter(r.db.Model(&entities.Item{}), filter).Select("1").Limit(limit)
+
+	var count int64
+	err := r.db.Table("(?) AS capped", sub).Count(&count).Error
+	return count, err
+}
+
+func applyItemFilter(tx *gorm.DB, f entities.ItemFilter) *gorm.DB {
+	if f.NamePrefix != "" {
+		tx = tx.Where(`product_name ILIKE ? ESCAPE '\'`, escapeLike(f.NamePrefix)+"%")
+	}
+	if f.OwnerID != 0 {
+		tx = tx.Where("owner_id = ?", f.OwnerID)
+	}
+	if f.Category != "" {
+		tx = tx.Where(`category_id IN (
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM categories WHERE slug = ?
+				UNION
+				SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+			)
+			SELECT id FROM subtree)`, f.Category)
+	}
+	if len(f.Tags) > 0 {
+		// Items carrying every tag; f.Tags holds no duplicates
+		tx = tx.Where(`product_id IN (
+			SELECT it.item_product_id FROM item_tags it JOIN tags t ON t.id = it.tag_id
+			WHERE t.name IN ?
+			GROUP BY it.item_product_id
+			HAVING count(*) = ?)`, f.Tags, len(f.Tags))
+	}
+	return tx
 }
 
-func (r *ItemRepositoryPostgres) Update(id uint, name, desc, img string) error {
+func itemSortColumn(field entities.ItemSortField) string {
+	switch field {
+	case entities.ItemSortName:
+		return "product_name"
+	case entities.ItemSortCreated:
+		return "created_at"
+	}
+	return "product_id"
+}
 
-	result := r.db.Model(&entities.Item{}).
-		Where("product_id = ?", id).
-		Updates(entities.Item{
-			ProductName:     name,
-			ProductDesc:     desc,
-			ProductImageKey: img,
-		})
+// escapeLike makes LIKE wildcards in user input match literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
 
-	if result.Error != nil {
-		return result.Error
+// Update applies the changes in u to an item.
+func (r *ItemRepositoryPostgres) Update(id uint, u entities.ItemUpdate) error {
+	changes := map[string]interface{}{}
+	if u.Name != "" {
+		changes["product_name"] = u.Name
+	}
+	if u.Desc != "" {
+		changes["product_desc"] = u.Desc
+	}
+	if u.ImageKey != "" {
+		changes["product_image_key"] = u.ImageKey
+	}
+	if u.CategoryID != nil {
+		if *u.CategoryID == 0 {
+			changes["category_id"] = nil
+		} else {
+			changes["category_id"] = *u.CategoryID
+		}
+	}
+	if u.PriceMinor != nil {
+		changes["price_minor"] = *u.PriceMinor
+	}
+	if u.Currency != "" {
+		changes["currency"] = u.Currency
 	}
 
-	if result.RowsAffected == 0 {
-		return errors.New("item not found")
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if len(changes) > 0 {
+			result := tx.Model(&entities.Item{}).
+				Where("product_id = ?", id).
+				Updates(changes)
+
+			if result.Error != nil {
+				return result.Error
+			}
+
+			if result.RowsAffected == 0 {
+				return entities.ErrItemNotFound
+			}
+		}
+
+		if u.Tags != nil {
+			return tx.Model(&entities.Item{ProductID: id}).Association("Tags").Replace(u.Tags)
+		}
+		return nil
+	})
+}
+
+// ResolveTags returns the tags with the given names, creating missing ones.
+func (r *ItemRepositoryPostgres) ResolveTags(names []string) ([]entities.Tag, error) {
+	tags := []entities.Tag{}
+	if len(names) == 0 {
+		return tags, nil
 	}
 
-	return nil
+	created := make([]entities.Tag, len(names))
+	for i, name := range names {
+		created[i] = entities.Tag{Name: name}
+	}
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoNothing: true,
+	}).Create(&created).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.Where("name IN ?", names).Order("name").Find(&tags).Error
+	return tags, err
 }
 
 func (r *ItemRepositoryPostgres) Delete(id uint) error {
-	result := r.db.Where("product_id = ?", id).Delete(&entities.Item{})
+	result := r.db.Select("Tags", "Variants").Delete(&entities.Item{ProductID: id})
+
+	if result.Error != nil {
+		return result.Error
+	}
 
 	if result.RowsAffected == 0 {
-		return errors.New("item not found")
+		return entities.ErrItemNotFound
 	}
 	return nil
 }
@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"hole/entities"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Rank weights of matches in names and descriptions, after the defaults
+// ts_rank applies to the A and B weights of the Postgres index.
+const (
+	nameMatchWeight = 1.0
+	descMatchWeight = 0.4
+)
+
+// snippetWords bounds the length of a snippet, like MaxWords of ts_headline.
+const snippetWords = 30
+
+// ItemSearchRepositoryMemory searches items held in process memory. It is
+// meant for tests: matching follows ItemSearchRepositoryPostgres, while
+// ranks and snippet boundaries are only approximations of it.
+type ItemSearchRepositoryMemory struct {
+	mu    sync.Mutex
+	items map[uint]entities.Item
+}
+
+func NewItemSearchRepositoryMemory() *ItemSearchRepositoryMemory {
+	return &ItemSearchRepositoryMemory{items: map[uint]entities.Item{}}
+}
+
+// Put adds an item to the index or replaces it.
+func (r *ItemSearchRepositoryMemory) Put(item entities.Item) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.items[item.ProductID] = item
+}
+
+func (r *ItemSearchRepositoryMemory) Remove(id uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.items, id)
+}
+
+func (r *ItemSearchRepositoryMemory) Search(q entities.ItemSearchQuery) ([]*entities.ItemSearchHit, error) {
+	hits := r.matches(q)
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Rank != hits[j].Rank {
+			return hits[i].Rank > hits[j].Rank
+		}
+		return hits[i].ProductID < hits[j].ProductID
+	})
+
+	if q.Offset >= len(hits) {
+		return []*entities.ItemSearchHit{}, nil
+	}
+	hits = hits[q.Offset:]
+	if q.Limit < len(hits) {
+		hits = hits[:q.Limit]
+	}
+
+	for _, hit := range hits {
+		text := hit.ProductDesc
+		if text == "" {
+			text = hit.ProductName
+		}
+		hit.Snippet = markSnippet(highlight(text, q))
+	}
+	return hits, nil
+}
+
+func (r *ItemSearchRepositoryMemory) CountMatches(q entities.ItemSearchQuery, limit int) (int64, error) {
+	count := len(r.matches(q))
+	if count > limit {
+		count = limit
+	}
+	return int64(count), nil
+}
+
+// matches returns every item containing all terms, with its rank.
+func (r *ItemSearchRepositoryMemory) matches(q entities.ItemSearchQuery) []*entities.ItemSearchHit {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var hits []*entities.ItemSearchHit
+	for _, item := range r.items {
+		name := entities.SearchTerms(item.ProductName)
+		desc := entities.SearchTerms(item.ProductDesc)
+
+		rank := 0.0
+		for i := range q.Terms {
+			n, d := countTerm(name, q, i), countTerm(desc, q, i)
+			if n+d == 0 {
+				rank = 0
+				break
+			}
+			rank += float64(n)*nameMatchWeight + float64(d)*descMatchWeight
+		}
+		if rank > 0 {
+			if !q.IncludeVariants {
+				item.Variants = nil
+			}
+			hits = append(hits, &entities.ItemSearchHit{Item: item, Rank: rank})
+		}
+	}
+	return hits
+}
+
+// countTerm counts the words matching the i-th term of q.
+func countTerm(words []string, q entities.ItemSearchQuery, i int) int {
+	n := 0
+	for _, w := range words {
+		if termMatches(w, q, i) {
+			n++
+		}
+	}
+	return n
+}
+
+func termMatches(word string, q entities.ItemSearchQuery, i int) bool {
+	if q.Prefix && i == len(q.Terms)-1 {
+		return strings.HasPrefix(word, q.Terms[i])
+	}
+	return word == q.Terms[i]
+}
+
+// highlight wraps the words of text matching any term in the highlight
+// delimiters, keeping at most snippetWords words around the first match.
+func highlight(text string, q entities.ItemSearchQuery) string {
+	type span struct{ start, end int }
+
+	var words []span
+	start := -1
+	for i, r := range text + " " {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case isWord && start < 0:
+			start = i
+		case !isWord && start >= 0:
+			words = append(words, span{start, i})
+			start = -1
+		}
+	}
+
+	matched := make([]bool, len(words))
+	first := -1
+	for i, w := range words {
+		word := strings.ToLower(text[w.start:w.end])
+		for t := range q.Terms {
+			if termMatches(word, q, t) {
+				matched[i] = true
+				break
+			}
+		}
+		if matched[i] && first < 0 {
+			first = i
+		}
+	}
+
+	from, to := 0, len(words)
+	if to > snippetWords {
+		if first > snippetWords/3 {
+			from = first - snippetWords/3
+		}
+		if from+snippetWords < to {
+			to = from + snippetWords
+		}
+	}
+	if from >= to {
+		return ""
+	}
+
+	// Text around the words is kept at either end the snippet is not cut
+	var b strings.Builder
+	pos := words[from].start
+	if from == 0 {
+		pos = 0
+	}
+	for i := from; i < to; i++ {
+		w := words[i]
+		b.WriteString(text[pos:w.start])
+		if matched[i] {
+			b.WriteString(markStart + text[w.start:w.end] + markStop)
+		} else {
+			b.WriteString(text[w.start:w.end])
+		}
+		pos = w.end
+	}
+	if to == len(words) {
+		b.WriteString(text[pos:])
+	}
+	return b.String()
+}
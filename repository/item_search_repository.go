@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"hole/entities"
+	"html"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// searchConfig is the text search configuration of the index. "simple" only
+// lower-cases words, without stemming or stop words, so that results do not
+// depend on the language of a product and match ItemSearchRepositoryMemory.
+const searchConfig = "simple"
+
+// Snippet highlights are delimited with private-use characters so that the
+// snippet can be HTML-escaped before they are turned into <mark> tags.
+const (
+	markStart = "\uE000"
+	markStop  = "\uE001"
+)
+
+type ItemSearchRepositoryPostgres struct {
+	db *gorm.DB
+}
+
+func NewItemSearchRepository(db *gorm.DB) *ItemSearchRepositoryPostgres {
+	return &ItemSearchRepositoryPostgres{db}
+}
+
+// Migrate adds the generated search_vector column and its GIN index. Names
+// weigh more than descriptions in the ranking.
+func (r *ItemSearchRepositoryPostgres) Migrate() error {
+	if err := r.db.Exec(`ALTER TABLE items ADD COLUMN IF NOT EXISTS search_vector tsvector
+		GENERATED ALWAYS AS (
+			setweight(to_tsvector('` + searchConfig + `', coalesce(product_name, '')), 'A') ||
+			setweight(to_tsvector('` + searchConfig + `', coalesce(product_desc, '')), 'B')
+		) STORED`).Error; err != nil {
+		return err
+	}
+	return r.db.Exec(`CREATE INDEX IF NOT EXISTS idx_items_search_vector ON items USING GIN (search_vector)`).Error
+}
+
+func (r *ItemSearchRepositoryPostgres) Search(q entities.ItemSearchQuery) ([]*entities.ItemSearchHit, error) {
+	// Snippets are built for the returned page only, not every match
+	var hits []*entities.ItemSearchHit
+	err := r.db.Raw(`SELECT page.*, ts_headline(?, coalesce(nullif(page.product_desc, ''), page.product_name), page.query, ?) AS snippet
+		FROM (
+			SELECT items.*, ts_rank_cd(items.search_vector, query) AS rank, query
+			FROM items, to_tsquery(?, ?) AS query
+			WHERE items.search_vector @@ query
+			ORDER BY rank DESC, items.product_id
+			LIMIT ? OFFSET ?
+		) AS page
+		ORDER BY page.rank DESC, page.product_id`,
+		searchConfig, "StartSel="+markStart+", StopSel="+markStop+", MinWords=10, MaxWords=30",
+		searchConfig, tsQuery(q), q.Limit, q.Offset,
+	).Scan(&hits).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hit := range hits {
+		hit.Snippet = markSnippet(hit.Snippet)
+	}
+	return hits, r.loadRelations(hits, q.IncludeVariants)
+}
+
+// loadRelations fills in the tags, and optionally the variants, of hits.
+func (r *ItemSearchRepositoryPostgres) loadRelations(hits []*entities.ItemSearchHit, variants bool) error {
+	if len(hits) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ProductID
+	}
+	tx := r.db.Select("product_id").Preload("Tags")
+	if variants {
+		tx = tx.Preload("Variants", func(db *gorm.DB) *gorm.DB { return db.Order("id") })
+	}
+	var items []entities.Item
+	if err := tx.Find(&items, ids).Error; err != nil {
+		return err
+	}
+
+	loaded := make(map[uint]entities.Item, len(items))
+	for _, item := range items {
+		loaded[item.ProductID] = item
+	}
+	for _, hit := range hits {
+		hit.Tags = loaded[hit.ProductID].Tags
+		hit.Variants = loaded[hit.ProductID].Variants
+	}
+	return nil
+}
+
+// CountMatches counts matching items, stopping at limit.
+func (r *ItemSearchRepositoryPostgres) CountMatches(q entities.ItemSearchQuery, limit int) (int64, error) {
+	var count int64
+	err := r.db.Raw(`SELECT count(*) FROM (
+			SELECT 1 FROM items WHERE search_vector @@ to_tsquery(?, ?) LIMIT ?
+		) AS capped`,
+		searchConfig, tsQuery(q), limit,
+	).Scan(&count).Error
+	return count, err
+}
+
+// tsQuery joins the terms with AND. Terms consist of letters and digits
+// only, so they cannot inject tsquery operators.
+func tsQuery(q entities.ItemSearchQuery) string {
+	parts := make([]string, len(q.Terms))
+	copy(parts, q.Terms)
+	if q.Prefix && len(parts) > 0 {
+		parts[len(parts)-1] += ":*"
+	}
+	return strings.Join(parts, " & ")
+}
+
+// markSnippet escapes a snippet for HTML and turns the highlight delimiters
+// into <mark> tags.
+func markSnippet(s string) string {
+	return strings.NewReplacer(markStart, "<mark>", markStop, "</mark>").Replace(html.EscapeString(s))
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"hole/entities"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LoginAttemptRepositoryMemory keeps lockout state in process memory. It is
+// meant for tests and single-instance deployments.
+type LoginAttemptRepositoryMemory struct {
+	mu       sync.Mutex
+	attempts map[string]entities.LoginAttempt
+}
+
+func NewLoginAttemptRepositoryMemory() *LoginAttemptRepositoryMemory {
+	return &LoginAttemptRepositoryMemory{attempts: map[string]entities.LoginAttempt{}}
+}
+
+func (r *LoginAttemptRepositoryMemory) Find(key string) (*entities.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a, ok := r.attempts[key]
+	if !ok {
+		a = entities.LoginAttempt{Key: key}
+	}
+	return &a, nil
+}
+
+func (r *LoginAttemptRepositoryMemory) RecordFailure(key string, at time.Time) (*entities.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a := r.attempts[key]
+	a.Key = key
+	a.Failures++
+	a.LastFailure = at
+	r.attempts[key] = a
+	return &a, nil
+}
+
+func (r *LoginAttemptRepositoryMemory) Lock(key string, until time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if a, ok := r.attempts[key]; ok {
+		a.LockedUntil = until
+		r.attempts[key] = a
+	}
+	return nil
+}
+
+func (r *LoginAttemptRepositoryMemory) Reset(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.attempts, key)
+	return nil
+}
+
+func (r *LoginAttemptRepositoryMemory) ListLocked(now time.Time) ([]*entities.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var locked []*entities.LoginAttempt
+	for _, a := range r.attempts {
+		if a.Locked(now) {
+			a := a
+			locked = append(locked, &a)
+		}
+	}
+	sort.Slice(locked, func(i, j int) bool {
+		return locked[i].LockedUntil.After(locked[j].LockedUntil)
+	})
+	return locked, nil
+}
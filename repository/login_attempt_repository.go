@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"errors"
+	"hole/entities"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginAttemptRepositoryPostgres shares lockout state between replicas.
+type LoginAttemptRepositoryPostgres struct {
+	db *gorm.DB
+}
+
+func NewLoginAttemptRepository(db *gorm.DB) *LoginAttemptRepositoryPostgres {
+	return &LoginAttemptRepositoryPostgres{db}
+}
+
+func (r *LoginAttemptRepositoryPostgres) Find(key string) (*entities.LoginAttempt, error) {
+	var a entities.LoginAttempt
+	err := r.db.Where("key = ?", key).First(&a).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &entities.LoginAttempt{Key: key}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *LoginAttemptRepositoryPostgres) RecordFailure(key string, at time.Time) (*entities.LoginAttempt, error) {
+	a := entities.LoginAttempt{Key: key, Failures: 1, LastFailure: at}
+	err := r.db.Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "key"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"failures":     gorm.Expr("login_attempts.failures + 1"),
+				"last_failure": at,
+			}),
+		},
+		clause.Returning{},
+	).Create(&a).Error
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *LoginAttemptRepositoryPostgres) Lock(key string, until time.Time) error {
+	return r.db.Model(&entities.LoginAttempt{}).
+		Where("key = ?", key).
+		Update("locked_until", until).Error
+}
+
+func (r *LoginAttemptRepositoryPostgres) Reset(key string) error {
+	return r.db.Where("key = ?", key).Delete(&entities.LoginAttempt{}).Error
+}
+
+func (r *LoginAttemptRepositoryPostgres) ListLocked(now time.Time) ([]*entities.LoginAttempt, error) {
+	var attempts []*entities.LoginAttempt
+	err := r.db.Where("locked_until > ?", now).Order("locked_until DESC").Find(&attempts).Error
+	return attempts, err
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hole/entities"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OIDCStateRepositoryPostgres stores pending sign-ins keyed by a SHA-256 hash
+// of their state parameter.
+type OIDCStateRepositoryPostgres struct {
+	db *gorm.DB
+}
+
+func NewOIDCStateRepository(db *gorm.DB) *OIDCStateRepositoryPostgres {
+	return &OIDCStateRepositoryPostgres{db}
+}
+
+func (r *OIDCStateRepositoryPostgres) Create(s *entities.OIDCState) error {
+	return r.db.Create(&entities.OIDCState{
+		StateHash:    hashOIDCState(s.State),
+		Provider:     s.Provider,
+		Nonce:        s.Nonce,
+		CodeVerifier: s.CodeVerifier,
+		ExpiresAt:    s.ExpiresAt,
+	}).Error
+}
+
+// Consume deletes and returns an unexpired pending sign-in. Only one caller
+// can consume a given state; expired states are purged along the way.
+func (r *OIDCStateRepositoryPostgres) Consume(state string, now time.Time) (*entities.OIDCState, error) {
+	var rows []entities.OIDCState
+	err := r.db.Clauses(clause.Returning{}).
+		Where("state_hash = ?", hashOIDCState(state)).
+		Delete(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	r.db.Where("expires_at <= ?", now).Delete(&entities.OIDCState{})
+
+	if len(rows) == 0 || !now.Before(rows[0].ExpiresAt) {
+		return nil, entities.ErrInvalidToken
+	}
+	return &rows[0], nil
+}
+
+func hashOIDCState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
+
+type UserIdentityRepositoryPostgres struct {
+	db *gorm.DB
+}
+
+func NewUserIdentityRepository(db *gorm.DB) *UserIdentityRepositoryPostgres {
+	return &UserIdentityRepositoryPostgres{db}
+}
+
+func (r *UserIdentityRepositoryPostgres) Create(identity *entities.UserIdentity) error {
+	return r.db.Create(identity).Error
+}
+
+func (r *UserIdentityRepositoryPostgres) FindBySubject(provider, subject string) (*entities.UserIdentity, error) {
+	var identity entities.UserIdentity
+	err := r.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, entities.ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hole/entities"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OneTimeTokenRepositoryPostgres stores SHA-256 hashes of high-entropy
+// single-use tokens; the raw token never reaches the database.
+type OneTimeTokenRepositoryPostgres struct {
+	db *gorm.DB
+}
+
+func NewOneTimeTokenRepository(db *gorm.DB) *OneTimeTokenRepositoryPostgres {
+	return &OneTimeTokenRepositoryPostgres{db}
+}
+
+func (r *OneTimeTokenRepositoryPostgres) Create(t *entities.OneTimeToken) error {
+	return r.db.Create(&entities.OneTimeToken{
+		UserID:      t.UserID,
+		Purpose:     t.Purpose,
+		TokenHash:   hashOneTimeToken(t.Token),
+		BindingHash: hashBinding(t.Binding),
+		Email:       t.Email,
+		ExpiresAt:   t.ExpiresAt,
+	}).Error
+}
+
+// Consume marks an unused, unexpired token as used and returns it. Only one
+// caller can consume a given token.
+func (r *OneTimeTokenRepositoryPostgres) Consume(purpose, token string, now time.Time) (*entities.OneTimeToken, error) {
+	return r.ConsumeBound(purpose, token, "", now)
+}
+
+// ConsumeBound is Consume for tokens issued with a browser binding. A token
+// presented with the wrong binding is left untouched.
+func (r *OneTimeTokenRepositoryPostgres) ConsumeBound(purpose, token, binding string, now time.Time) (*entities.OneTimeToken, error) {
+	var t entities.OneTimeToken
+	result := r.db.Model(&t).
+		Clauses(clause.Returning{}).
+		Where("token_hash = ? AND purpose = ? AND binding_hash = ? AND used_at IS NULL AND expires_at > ?",
+			hashOneTimeToken(token), purpose, hashBinding(binding), now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, entities.ErrInvalidToken
+	}
+	return &t, nil
+}
+
+// Latest returns the most recently issued token of a purpose for the user.
+func (r *OneTimeTokenRepositoryPostgres) Latest(userID uint, purpose string) (*entities.OneTimeToken, error) {
+	var t entities.OneTimeToken
+	err := r.db.Where("user_id = ? AND purpose = ?", userID, purpose).
+		Order("created_at DESC").
+		First(&t).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, entities.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// InvalidateAll marks every outstanding token of a purpose for the user as used.
+func (r *OneTimeTokenRepositoryPostgres) InvalidateAll(userID uint, purpose string, now time.Time) error {
+	return r.db.Model(&entities.OneTimeToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", now).Error
+}
+
+func hashOneTimeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashBinding keeps unbound tokens recognisable by an empty hash.
+func hashBinding(binding string) string {
+	if binding == "" {
+		return ""
+	}
+	return hashOneTimeToken(binding)
+}
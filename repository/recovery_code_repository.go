@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hole/entities"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecoveryCodeRepositoryPostgres stores SHA-256 hashes of recovery codes.
+type RecoveryCodeRepositoryPostgres struct {
+	db *gorm.DB
+}
+
+func NewRecoveryCodeRepository(db *gorm.DB) *RecoveryCodeRepositoryPostgres {
+	return &RecoveryCodeRepositoryPostgres{db}
+}
+
+// Replace discards the user's previous codes and stores the new ones.
+func (r *RecoveryCodeRepositoryPostgres) Replace(userID uint, codes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&entities.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		rows := make([]entities.RecoveryCode, 0, len(codes))
+		for _, code := range codes {
+			rows = append(rows, entities.RecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(code)})
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+// Consume marks a matching unused code as used and reports whether one existed.
+func (r *RecoveryCodeRepositoryPostgres) Consume(userID uint, code string, now time.Time) (bool, error) {
+	result := r.db.Model(&entities.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashRecoveryCode(code)).
+		Update("used_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *RecoveryCodeRepositoryPostgres) DeleteAll(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&entities.RecoveryCode{}).Error
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,43 +1,166 @@
 package repository
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"hole/entities"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
 
+const tokenPrefixLen = 8
+
 type RefreshTokenRepositoryPostgres struct {
-	db *gorm.DB
+	db      *gorm.DB
+	hashKey []byte
 }
 
-func NewRefreshTokenRepository(db *gorm.DB) *RefreshTokenRepositoryPostgres {
-	return &RefreshTokenRepositoryPostgres{db}
+// NewRefreshTokenRepository stores refresh tokens as HMAC-SHA256 hashes
+// keyed with hashKey; the raw token never reaches the database.
+func NewRefreshTokenRepository(db *gorm.DB, hashKey []byte) *RefreshTokenRepositoryPostgres {
+	return &RefreshTokenRepositoryPostgres{db: db, hashKey: hashKey}
 }
 
 func (r *RefreshTokenRepositoryPostgres) Create(t *entities.RefreshToken) error {
 	return r.db.Create(&entities.RefreshToken{
-		UserID:    t.UserID,
-		Token:     t.Token,
-		ExpiresAt: t.ExpiresAt,
+		UserID:      t.UserID,
+		TokenHash:   r.hash(t.Token),
+		TokenPrefix: tokenPrefix(t.Token),
+		FamilyID:    t.FamilyID,
+		ParentID:    t.ParentID,
+		ExpiresAt:   t.ExpiresAt,
+		UserAgent:   t.UserAgent,
+		IP:          t.IP,
 	}).Error
 }
 
 func (r *RefreshTokenRepositoryPostgres) FindByToken(token string) (*entities.RefreshToken, error) {
 	var t entities.RefreshToken
-	if err := r.db.Where("token = ?", token).First(&t).Error; err != nil {
+	if err := r.db.Where("token_hash = ?", r.hash(token)).First(&t).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// FindByID returns a token row by its ID, revoked or not.
+func (r *RefreshTokenRepositoryPostgres) FindByID(id uint) (*entities.RefreshToken, error) {
+	var t entities.RefreshToken
+	if err := r.db.First(&t, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, entities.ErrSessionNotFound
+		}
 		return nil, err
 	}
-	return &entities.RefreshToken{
-		ID:        t.ID,
-		UserID:    t.UserID,
-		Token:     t.Token,
-		Revoked:   t.Revoked,
-		ExpiresAt: t.ExpiresAt,
-	}, nil
+	return &t, nil
+}
+
+// ListSessions returns one entry per active token of the user, newest first.
+// A family's start time is the creation time of its first token.
+func (r *RefreshTokenRepositoryPostgres) ListSessions(userID uint, now time.Time) ([]*entities.Session, error) {
+	var sessions []*entities.Session
+	err := r.db.Table("refresh_tokens AS rt").
+		Select(`rt.id, rt.family_id, rt.user_agent, rt.ip, rt.expires_at,
+			rt.created_at AS last_used_at,
+			COALESCE((SELECT MIN(f.created_at) FROM refresh_tokens f
+				WHERE f.family_id = rt.family_id AND f.family_id <> ''), rt.created_at) AS created_at`).
+		Where("rt.user_id = ? AND rt.revoked = ? AND rt.expires_at > ?", userID, false, now).
+		Order("rt.created_at DESC").
+		Scan(&sessions).Error
+	return sessions, err
+}
+
+func (r *RefreshTokenRepositoryPostgres) RevokeByID(id uint) error {
+	return r.db.Model(&entities.RefreshToken{}).
+		Where("id = ?", id).
+		Update("revoked", true).Error
 }
 
 func (r *RefreshTokenRepositoryPostgres) Revoke(token string) error {
 	return r.db.Model(&entities.RefreshToken{}).
-		Where("token = ?", token).
+		Where("token_hash = ?", r.hash(token)).
+		Update("revoked", true).Error
+}
+
+func (r *RefreshTokenRepositoryPostgres) RevokeAllForUser(userID uint) error {
+	return r.db.Model(&entities.RefreshToken{}).
+		Where("user_id = ? AND revoked = ?", userID, false).
+		Update("revoked", true).Error
+}
+
+func (r *RefreshTokenRepositoryPostgres) MarkRotated(token string) (bool, error) {
+	result := r.db.Model(&entities.RefreshToken{}).
+		Where("token_hash = ? AND revoked = ?", r.hash(token), false).
+		Updates(map[string]interface{}{"revoked": true, "rotated": true, "last_used_at": time.Now()})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *RefreshTokenRepositoryPostgres) RevokeFamily(familyID string) error {
+	return r.db.Model(&entities.RefreshToken{}).
+		Where("family_id = ? AND revoked = ?", familyID, false).
 		Update("revoked", true).Error
 }
+
+// MigratePlaintextTokens hashes rows written before tokens were stored hashed
+// and drops the legacy plaintext column. It is a no-op once the column is gone.
+func (r *RefreshTokenRepositoryPostgres) MigratePlaintextTokens() error {
+	migrator := r.db.Migrator()
+	if !migrator.HasColumn(&entities.RefreshToken{}, "token") {
+		return nil
+	}
+
+	var rows []struct {
+		ID    uint
+		Token string
+	}
+	if err := r.db.Table("refresh_tokens").
+		Select("id, token").
+		Where("token IS NOT NULL AND token <> ''").
+		Find(&rows).Error; err != nil {
+		return err
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			if err := tx.Model(&entities.RefreshToken{}).
+				Where("id = ?", row.ID).
+				Updates(map[string]interface{}{
+					"token_hash":   r.hash(row.Token),
+					"token_prefix": tokenPrefix(row.Token),
+				}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Migrator().DropColumn(&entities.RefreshToken{}, "token")
+	})
+}
+
+// BackfillCreatedAt estimates the creation time of tokens stored before it was
+// recorded from their expiry and the lifetime they were issued with.
+func (r *RefreshTokenRepositoryPostgres) BackfillCreatedAt(ttl time.Duration) error {
+	return r.db.Model(&entities.RefreshToken{}).
+		Where("created_at IS NULL").
+		Update("created_at", gorm.Expr("expires_at - make_interval(secs => ?)", ttl.Seconds())).Error
+}
+
+func (r *RefreshTokenRepositoryPostgres) hash(token string) string {
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// tokenPrefix keeps the start of the JWT signature so a token can be
+// recognised in logs and support requests without being usable.
+func tokenPrefix(token string) string {
+	sig := token[strings.LastIndex(token, ".")+1:]
+	if len(sig) > tokenPrefixLen {
+		sig = sig[:tokenPrefixLen]
+	}
+	return sig
+}
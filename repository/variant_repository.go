@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"errors"
+	"hole/entities"
+
+	"gorm.io/gorm"
+)
+
+type VariantRepositoryPostgres struct {
+	db *gorm.DB
+}
+
+func NewVariantRepository(db *gorm.DB) *VariantRepositoryPostgres {
+	return &VariantRepositoryPostgres{db}
+}
+
+// Create stores a variant; its initial stock, if any, is recorded in the
+// inventory ledger of the item.
+func (r *VariantRepositoryPostgres) Create(variant *entities.Variant, actorID uint) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(variant).Error; err != nil {
+			return err
+		}
+		if variant.Stock == 0 {
+			return nil
+		}
+		return tx.Create(&entities.InventoryAdjustment{
+			ItemID:     variant.ItemID,
+			VariantID:  &variant.ID,
+			Delta:      variant.Stock,
+			Reason:     entities.InventoryInitial,
+			ActorID:    actorID,
+			StockAfter: variant.Stock,
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return entities.ErrSKUTaken
+	}
+	return err
+}
+
+func (r *VariantRepositoryPostgres) FindByID(itemID, id uint) (*entities.Variant, error) {
+	var variant entities.Variant
+	err := r.db.Where("id = ? AND item_id = ?", id, itemID).First(&variant).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, entities.ErrVariantNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
+
+func (r *VariantRepositoryPostgres) ListByItem(itemID uint) ([]*entities.Variant, error) {
+	var variants []*entities.Variant
+	err := r.db.Where("item_id = ?", itemID).Order("id").Find(&variants).Error
+	return variants, err
+}
+
+// Update replaces the SKU, options, price override and image of a variant;
+// its stock is left alone.
+func (r *VariantRepositoryPostgres) Update(variant *entities.Variant) error {
+	result := r.db.Model(&entities.Variant{}).
+		Where("id = ? AND item_id = ?", variant.ID, variant.ItemID).
+		Updates(map[string]interface{}{
+			"sku":         variant.SKU,
+			"options":     variant.Options,
+			"price_minor": variant.PriceMinor,
+			"image_key":   variant.ImageKey,
+		})
+	if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+		return entities.ErrSKUTaken
+	}
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return entities.ErrVariantNotFound
+	}
+	return nil
+}
+
+func (r *VariantRepositoryPostgres) Delete(itemID, id uint) error {
+	result := r.db.Where("id = ? AND item_id = ?", id, itemID).Delete(&entities.Variant{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return entities.ErrVariantNotFound
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"hole/adapters"
+	"hole/entities"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// endpoints holds the handler of every route, so that the route table and its
+// guards can be registered with stand-in handlers in tests.
+type endpoints struct {
+	JWKS fiber.Handler
+
+	Register         fiber.Handler
+	Login            fiber.Handler
+	LoginMFA         fiber.Handler
+	MagicLinkRequest fiber.Handler
+	MagicLinkLogin   fiber.Handler
+	OIDCLogin        fiber.Handler
+	OIDCCallback     fiber.Handler
+	Refresh          fiber.Handler
+	CSRFToken        fiber.Handler
+	Verify           fiber.Handler
+	ForgotPassword   fiber.Handler
+	ResetPassword    fiber.Handler
+
+	ResendVerification fiber.Handler
+
+	Me             fiber.Handler
+	UpdateMe       fiber.Handler
+	ChangePassword fiber.Handler
+
+	CreateAPIKey fiber.Handler
+	ListAPIKeys  fiber.Handler
+	RevokeAPIKey fiber.Handler
+
+	EnrollTOTP  fiber.Handler
+	ConfirmTOTP fiber.Handler
+	DisableTOTP fiber.Handler
+
+	UploadImage fiber.Handler
+	GetImage    fiber.Handler
+
+	CreateItem      fiber.Handler
+	ListItems       fiber.Handler
+	MyItems         fiber.Handler
+	SearchItems     fiber.Handler
+	UpdateItem      fiber.Handler
+	DeleteItem      fiber.Handler
+	ItemInventory   fiber.Handler
+	AdjustInventory fiber.Handler
+	ListVariants    fiber.Handler
+	GetVariant      fiber.Handler
+	CreateVariant   fiber.Handler
+	UpdateVariant   fiber.Handler
+	DeleteVariant   fiber.Handler
+
+	ListCategories fiber.Handler
+	GetCategory    fiber.Handler
+	CreateCategory fiber.Handler
+	UpdateCategory fiber.Handler
+	DeleteCategory fiber.Handler
+
+	AssignRole fiber.Handler
+	Lockouts   fiber.Handler
+	Unlock     fiber.Handler
+
+	Sessions      fiber.Handler
+	RevokeSession fiber.Handler
+
+	Logout fiber.Handler
+}
+
+// apiKeyScopes are the routes API keys may call, by scope.
+var apiKeyScopes = []adapters.ScopeRule{
+	{Pattern: "GET /items*", Scope: entities.ScopeItemsRead},
+	{Pattern: "GET /image/*", Scope: entities.ScopeItemsRead},
+	{Pattern: "POST /items", Scope: entities.ScopeItemsWrite},
+	{Pattern: "POST /items/*", Scope: entities.ScopeItemsWrite},
+	{Pattern: "PUT /items/*", Scope: entities.ScopeItemsWrite},
+	{Pattern: "DELETE /items/*", Scope: entities.ScopeItemsWrite},
+	{Pattern: "POST /image", Scope: entities.ScopeImagesWrite},
+	{Pattern: "GET /categories*", Scope: entities.ScopeItemsRead},
+	{Pattern: "POST /categories", Scope: entities.ScopeItemsWrite},
+	{Pattern: "PUT /categories/*", Scope: entities.ScopeItemsWrite},
+	{Pattern: "DELETE /categories/*", Scope: entities.ScopeItemsWrite},
+}
+
+// registerRoutes registers the public routes, then protect and the guards
+// that depend on the caller, then every authenticated route.
+func registerRoutes(app *fiber.App, e endpoints, protect fiber.Handler, unverifiedRoutes []string) {
+	app.Get("/.well-known/jwks.json", e.JWKS)
+
+	app.Post("/register", e.Register)
+	app.Post("/login", e.Login)
+	app.Post("/login/mfa", e.LoginMFA)
+	app.Post("/login/magic", e.MagicLinkRequest)
+	app.Get("/login/magic", e.MagicLinkLogin)
+	app.Get("/auth/oidc/:provider/login", e.OIDCLogin)
+	app.Get("/auth/oidc/:provider/callback", e.OIDCCallback)
+	app.Post("/refresh", e.Refresh)
+	app.Get("/csrf", e.CSRFToken)
+	app.Get("/verify", e.Verify)
+	app.Post("/password/forgot", e.ForgotPassword)
+	app.Post("/password/reset", e.ResetPassword)
+
+	app.Use(protect)
+	app.Use(adapters.CSRFProtect())
+	app.Use(adapters.RequireVerified(unverifiedRoutes))
+	app.Use(adapters.RequireAPIKeyScope(apiKeyScopes))
+
+	app.Post("/verify/resend", e.ResendVerification)
+
+	app.Get("/me", e.Me)
+	app.Patch("/me", e.UpdateMe)
+	app.Post("/me/password", e.ChangePassword)
+
+	app.Post("/api-keys", e.CreateAPIKey)
+	app.Get("/api-keys", e.ListAPIKeys)
+	app.Delete("/api-keys/:id", e.RevokeAPIKey)
+
+	app.Post("/mfa/totp/enroll", e.EnrollTOTP)
+	app.Post("/mfa/totp/confirm", e.ConfirmTOTP)
+	app.Post("/mfa/totp/disable", e.DisableTOTP)
+
+	editor := adapters.RequireRole(entities.RoleEditor)
+
+	app.Post("/image", editor, e.UploadImage)
+	app.Get("/image/*", e.GetImage)
+
+	app.Post("/items", editor, e.CreateItem)
+	app.Get("/items", e.ListItems)
+	app.Get("/items/mine", e.MyItems)
+	app.Get("/items/search", e.SearchItems)
+	app.Put("/items/:id", editor, e.UpdateItem)
+	app.Delete("/items/:id", editor, e.DeleteItem)
+	app.Get("/items/:id/inventory", e.ItemInventory)
+	app.Post("/items/:id/inventory", editor, e.AdjustInventory)
+	app.Get("/items/:id/variants", e.ListVariants)
+	app.Get("/items/:id/variants/:variantId", e.GetVariant)
+	app.Post("/items/:id/variants", editor, e.CreateVariant)
+	app.Put("/items/:id/variants/:variantId", editor, e.UpdateVariant)
+	app.Delete("/items/:id/variants/:variantId", editor, e.DeleteVariant)
+
+	requireAdmin := adapters.RequireRole(entities.RoleAdmin)
+
+	app.Get("/categories", e.ListCategories)
+	app.Get("/categories/:id", e.GetCategory)
+	app.Post("/categories", requireAdmin, e.CreateCategory)
+	app.Put("/categories/:id", requireAdmin, e.UpdateCategory)
+	app.Delete("/categories/:id", requireAdmin, e.DeleteCategory)
+
+	admin := app.Group("/admin", requireAdmin)
+	admin.Put("/users/:id/role", e.AssignRole)
+	admin.Get("/lockouts", e.Lockouts)
+	admin.Delete("/lockouts", e.Unlock)
+
+	app.Get("/sessions", e.Sessions)
+	app.Delete("/sessions/:id", e.RevokeSession)
+
+	app.Post("/logout", e.Logout)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"hole/adapters"
+	"hole/config"
+	"hole/entities"
+	"hole/use_cases"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// testUsers serves the users tokens are checked against; other methods of
+// UserRepository are not used by the middleware.
+type testUsers struct {
+	use_cases.UserRepository
+	users map[uint]*entities.User
+}
+
+func (r *testUsers) FindByID(id uint) (*entities.User, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return nil, entities.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// stubEndpoints answers every route with the name of its endpoint, so tests
+// can tell which handler a request reached.
+func stubEndpoints() endpoints {
+	var e endpoints
+	v := reflect.ValueOf(&e).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		v.Field(i).Set(reflect.ValueOf(fiber.Handler(func(c *fiber.Ctx) error {
+			return c.SendString(name)
+		})))
+	}
+	return e
+}
+
+// newTestApp registers the routes behind the real authentication middleware
+// and returns an access token for each role.
+func newTestApp(t *testing.T) (*fiber.App, map[entities.Role]string) {
+	t.Helper()
+	ring, err := adapters.NewKeyRing(config.JWTConfig{Secret: "routes-test-secret-routes-test-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtService := adapters.NewJWTService(ring, "routes-test-refresh-secret")
+
+	verified := time.Now()
+	users := &testUsers{users: map[uint]*entities.User{}}
+	tokens := map[entities.Role]string{}
+	for i, role := range []entities.Role{entities.RoleViewer, entities.RoleEditor, entities.RoleAdmin} {
+		id := uint(i + 1)
+		users.users[id] = &entities.User{ID: id, Role: role, VerifiedAt: &verified}
+		token, err := jwtService.GenerateAccessToken(id, 0, role, "session")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[role] = token
+	}
+
+	auth := use_cases.NewAuthUseCase(users, nil, jwtService, nil, nil, nil, nil)
+	app := fiber.New()
+	registerRoutes(app, stubEndpoints(), adapters.Protected(auth, nil), nil)
+	return app, tokens
+}
+
+func TestRoutesRequireRole(t *testing.T) {
+	app, tokens := newTestApp(t)
+
+	routes := []struct {
+		method, path string
+		endpoint     string
+		minRole      entities.Role
+	}{
+		{"GET", "/items", "ListItems", entities.RoleViewer},
+		{"POST", "/items", "CreateItem", entities.RoleEditor},
+		{"PUT", "/items/1", "UpdateItem", entities.RoleEditor},
+		{"DELETE", "/items/1", "DeleteItem", entities.RoleEditor},
+		{"POST", "/items/1/inventory", "AdjustInventory", entities.RoleEditor},
+		{"POST", "/items/1/variants", "CreateVariant", entities.RoleEditor},
+		{"PUT", "/items/1/variants/2", "UpdateVariant", entities.RoleEditor},
+		{"DELETE", "/items/1/variants/2", "DeleteVariant", entities.RoleEditor},
+		{"POST", "/image", "UploadImage", entities.RoleEditor},
+		{"GET", "/categories", "ListCategories", entities.RoleViewer},
+		{"POST", "/categories", "CreateCategory", entities.RoleAdmin},
+		{"PUT", "/categories/1", "UpdateCategory", entities.RoleAdmin},
+		{"DELETE", "/categories/1", "DeleteCategory", entities.RoleAdmin},
+		{"PUT", "/admin/users/1/role", "AssignRole", entities.RoleAdmin},
+		{"GET", "/admin/lockouts", "Lockouts", entities.RoleAdmin},
+		{"DELETE", "/admin/lockouts", "Unlock", entities.RoleAdmin},
+	}
+	callers := []entities.Role{"", entities.RoleViewer, entities.RoleEditor, entities.RoleAdmin}
+
+	for _, route := range routes {
+		for _, role := range callers {
+			name := string(role)
+			if name == "" {
+				name = "anonymous"
+			}
+			t.Run(name+" "+route.method+" "+route.path, func(t *testing.T) {
+				req := httptest.NewRequest(route.method, route.path, nil)
+				if role != "" {
+					req.Header.Set("Authorization", "Bearer "+tokens[role])
+				}
+				resp, err := app.Test(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ := io.ReadAll(resp.Body)
+
+				want := fiber.StatusOK
+				switch {
+				case role == "":
+					want = fiber.StatusUnauthorized
+				case !role.Includes(route.minRole):
+					want = fiber.StatusForbidden
+				}
+				if resp.StatusCode != want {
+					t.Fatalf("status = %d, want %d (%s)", resp.StatusCode, want, body)
+				}
+				if want == fiber.StatusOK && string(body) != route.endpoint {
+					t.Errorf("reached %s, want %s", body, route.endpoint)
+				}
+			})
+		}
+	}
+}
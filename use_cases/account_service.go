@@ -0,0 +1,85 @@
+package use_cases
+
+import (
+	"errors"
+	"hole/entities"
+	"strings"
+)
+
+var (
+	ErrWrongPassword      = errors.New("current password is incorrect")
+	ErrInvalidDisplayName = errors.New("display name must be at most 100 characters")
+)
+
+// AccountUseCase lets an authenticated user manage their own account.
+type AccountUseCase struct {
+	users     UserRepository
+	passwords *PasswordPolicy
+	verifier  *VerificationUseCase
+	auth      *AuthUseCase
+}
+
+func NewAccountUseCase(users UserRepository, passwords *PasswordPolicy, verifier *VerificationUseCase, auth *AuthUseCase) *AccountUseCase {
+	return &AccountUseCase{users: users, passwords: passwords, verifier: verifier, auth: auth}
+}
+
+func (uc *AccountUseCase) Profile(userID uint) (*entities.User, error) {
+	return uc.users.FindByID(userID)
+}
+
+// UpdateProfile changes the fields that are not nil. A new email only takes
+// effect once confirmed through the link sent to it.
+func (uc *AccountUseCase) UpdateProfile(userID uint, displayName, email *string) (*entities.User, error) {
+	user, err := uc.users.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if displayName != nil {
+		name := strings.TrimSpace(*displayName)
+		if len([]rune(name)) > 100 {
+			return nil, ErrInvalidDisplayName
+		}
+		if err := uc.users.UpdateDisplayName(userID, name); err != nil {
+			return nil, err
+		}
+		user.DisplayName = name
+	}
+
+	if email != nil {
+		if err := uc.verifier.RequestEmailChange(user, *email); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// ChangePassword replaces the password, revokes every session and returns a
+// fresh token pair for the caller's own session.
+func (uc *AccountUseCase) ChangePassword(userID uint, current, next string, client entities.ClientInfo) (string, string, error) {
+	user, err := uc.users.FindByID(userID)
+	if err != nil {
+		return "", "", err
+	}
+
+	if !uc.passwords.Compare([]byte(user.Password), current) {
+		return "", "", ErrWrongPassword
+	}
+	if err := uc.passwords.Validate(next); err != nil {
+		return "", "", err
+	}
+
+	hash, err := uc.passwords.Hash(next)
+	if err != nil {
+		return "", "", err
+	}
+	if err := uc.users.UpdatePassword(userID, hash); err != nil {
+		return "", "", err
+	}
+
+	if err := uc.auth.LogoutAll(userID); err != nil {
+		return "", "", err
+	}
+	return uc.auth.StartSession(userID, client)
+}
@@ -0,0 +1,46 @@
+package use_cases
+
+import (
+	"errors"
+	"hole/entities"
+	"time"
+)
+
+var ErrCannotChangeOwnRole = errors.New("admins cannot change their own role")
+
+// AdminUseCase holds the operations reserved for admins.
+type AdminUseCase struct {
+	users    UserRepository
+	throttle *LoginThrottle
+}
+
+func NewAdminUseCase(users UserRepository, throttle *LoginThrottle) *AdminUseCase {
+	return &AdminUseCase{users: users, throttle: throttle}
+}
+
+// AssignRole changes another user's role. The change applies to that user's
+// next access token; current ones are invalidated.
+func (uc *AdminUseCase) AssignRole(actorID, userID uint, role entities.Role) (*entities.User, error) {
+	if !role.Valid() {
+		return nil, entities.ErrInvalidRole
+	}
+	// Keeps the last admin from locking everyone out by accident
+	if actorID == userID {
+		return nil, ErrCannotChangeOwnRole
+	}
+
+	if err := uc.users.UpdateRole(userID, role); err != nil {
+		return nil, err
+	}
+	return uc.users.FindByID(userID)
+}
+
+// Lockouts lists the accounts and client IPs that are currently locked.
+func (uc *AdminUseCase) Lockouts() ([]*entities.LoginAttempt, error) {
+	return uc.throttle.Lockouts(time.Now())
+}
+
+// Unlock clears a lockout by its key, e.g. "account:user@example.com".
+func (uc *AdminUseCase) Unlock(key string) error {
+	return uc.throttle.Unlock(key)
+}
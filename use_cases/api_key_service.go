@@ -0,0 +1,141 @@
+package use_cases
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"hole/entities"
+	"slices"
+	"strings"
+	"time"
+)
+
+// apiKeyTag starts every key so that leaked keys are easy to recognise and
+// to find with secret scanners.
+const apiKeyTag = "hole_"
+
+// apiKeyTouchInterval limits how often last-used timestamps are written.
+const apiKeyTouchInterval = time.Minute
+
+var (
+	ErrInvalidAPIKey       = errors.New("invalid or expired api key")
+	ErrInvalidAPIKeyName   = errors.New("api key name is required and must be at most 100 characters")
+	ErrInvalidScope        = errors.New("invalid or missing scopes")
+	ErrInvalidAPIKeyExpiry = errors.New("api key expiry must be in the future")
+)
+
+type APIKeyRepository interface {
+	Create(key *entities.APIKey) error
+	FindByKey(prefix, key string) (*entities.APIKey, error)
+	ListByUser(userID uint) ([]*entities.APIKey, error)
+	Revoke(id, userID uint, at time.Time) error
+	TouchLastUsed(id uint, at time.Time) error
+}
+
+// APIKeyUseCase manages personal API keys and authenticates requests made
+// with them.
+type APIKeyUseCase struct {
+	keys  APIKeyRepository
+	users UserRepository
+}
+
+func NewAPIKeyUseCase(keys APIKeyRepository, users UserRepository) *APIKeyUseCase {
+	return &APIKeyUseCase{keys: keys, users: users}
+}
+
+// Create issues a new key. The returned APIKey carries the raw key in Key;
+// it cannot be recovered later.
+func (uc *APIKeyUseCase) Create(userID uint, name string, scopes []string, expiresAt *time.Time) (*entities.APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > 100 {
+		return nil, ErrInvalidAPIKeyName
+	}
+
+	if len(scopes) == 0 {
+		return nil, ErrInvalidScope
+	}
+	granted := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !slices.Contains(entities.APIKeyScopes, scope) {
+			return nil, ErrInvalidScope
+		}
+		if !slices.Contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, ErrInvalidAPIKeyExpiry
+	}
+
+	prefix, secret := randomHex(6), randomHex(32)
+	key := &entities.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Key:       apiKeyTag + prefix + "_" + secret,
+		Prefix:    prefix,
+		Scopes:    strings.Join(granted, " "),
+		ExpiresAt: expiresAt,
+	}
+	if err := uc.keys.Create(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// List returns the user's keys that have not been revoked.
+func (uc *APIKeyUseCase) List(userID uint) ([]*entities.APIKey, error) {
+	return uc.keys.ListByUser(userID)
+}
+
+func (uc *APIKeyUseCase) Revoke(userID, id uint) error {
+	return uc.keys.Revoke(id, userID, time.Now())
+}
+
+// Authenticate resolves a raw key to a principal limited to the key's scopes.
+// The role and verification state come from the owning user.
+func (uc *APIKeyUseCase) Authenticate(raw string) (*entities.Principal, error) {
+	prefix, _, ok := strings.Cut(strings.TrimPrefix(raw, apiKeyTag), "_")
+	if !ok || !strings.HasPrefix(raw, apiKeyTag) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := uc.keys.FindByKey(prefix, raw)
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if !key.Active(now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	user, err := uc.users.FindByID(key.UserID)
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+		// A failed timestamp update must not fail the request
+		_ = uc.keys.TouchLastUsed(key.ID, now)
+	}
+
+	scopes := key.ScopeList()
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	return &entities.Principal{
+		UserID:   user.ID,
+		Verified: user.Verified(),
+		Role:     user.Role,
+		APIKeyID: key.ID,
+		Scopes:   scopes,
+	}, nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
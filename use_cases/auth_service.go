@@ -1,65 +1,234 @@
 package use_cases
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
 	"hole/entities"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+	ErrRefreshTokenRevoked = errors.New("refresh token revoked")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrInvalidAccessToken  = errors.New("invalid access token")
+	ErrSessionRevoked      = errors.New("session revoked")
+	ErrInvalidCredentials  = errors.New("invalid email or password")
 )
 
 type UserRepository interface {
 	Create(user *entities.User) error
 	FindByEmail(email string) (*entities.User, error)
+	FindByID(id uint) (*entities.User, error)
+	IncrementTokenVersion(id uint) error
+	MarkVerified(id uint, at time.Time) error
+	UpdatePassword(id uint, hash string) error
+	UpdateDisplayName(id uint, name string) error
+	UpdateEmail(id uint, email string, verifiedAt time.Time) error
+	UpdateRole(id uint, role entities.Role) error
 }
 
 type RefreshTokenRepository interface {
 	Create(token *entities.RefreshToken) error
 	FindByToken(token string) (*entities.RefreshToken, error)
 	Revoke(token string) error
+	RevokeAllForUser(userID uint) error
+	// MarkRotated revokes an active token as part of a rotation and reports
+	// whether this call was the one that changed it.
+	MarkRotated(token string) (bool, error)
+	RevokeFamily(familyID string) error
+	FindByID(id uint) (*entities.RefreshToken, error)
+	RevokeByID(id uint) error
+	ListSessions(userID uint, now time.Time) ([]*entities.Session, error)
+}
+
+type SecurityEventPublisher interface {
+	Publish(event entities.SecurityEvent)
 }
 
 type TokenService interface {
-	GenerateAccessToken(userID uint) (string, error)
+	GenerateAccessToken(userID, tokenVersion uint, role entities.Role, sessionID string) (string, error)
 	GenerateRefreshToken(userID uint) (string, error)
 	ValidateAccessToken(token string) (jwt.MapClaims, error)
+	MFATokenService
+}
+
+// LoginResult holds either a token pair or, for accounts with two-factor
+// authentication, the challenge to present to POST /login/mfa.
+type LoginResult struct {
+	AccessToken  string
+	RefreshToken string
+	MFAChallenge string
 }
 
 type AuthUseCase struct {
 	repo        UserRepository
 	refreshRepo RefreshTokenRepository
 	token       TokenService
+	events      SecurityEventPublisher
+	throttle    *LoginThrottle
+	passwords   *PasswordPolicy
+	verifier    *VerificationUseCase
 }
 
-func NewAuthUseCase(r UserRepository, re RefreshTokenRepository, t TokenService) *AuthUseCase {
-	return &AuthUseCase{repo: r, refreshRepo: re, token: t}
+func NewAuthUseCase(r UserRepository, re RefreshTokenRepository, t TokenService, ev SecurityEventPublisher, th *LoginThrottle, pw *PasswordPolicy, v *VerificationUseCase) *AuthUseCase {
+	return &AuthUseCase{repo: r, refreshRepo: re, token: t, events: ev, throttle: th, passwords: pw, verifier: v}
 }
 
 func (u *AuthUseCase) Register(email, password string) error {
-	return u.repo.Create(&entities.User{
+	email = NormalizeEmail(email)
+	if err := ValidateEmail(email); err != nil {
+		return err
+	}
+	if err := u.passwords.Validate(password); err != nil {
+		return err
+	}
+
+	hash, err := u.passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	user := &entities.User{
 		Email:    email,
-		Password: password,
-	})
+		Password: hash,
+	}
+	if err := u.repo.Create(user); err != nil {
+		return err
+	}
+
+	u.verifier.sendAfterRegister(user)
+	return nil
 }
 
-func (uc *AuthUseCase) Login(email, password string) (string, string, error) {
+func (uc *AuthUseCase) Login(email, password string, client entities.ClientInfo) (*LoginResult, error) {
+	email = NormalizeEmail(email)
+
+	now := time.Now()
+	if err := uc.throttle.Check(email, client.IP, now); err != nil {
+		return nil, err
+	}
+
 	user, err := uc.repo.FindByEmail(email)
+	if err != nil && !errors.Is(err, entities.ErrUserNotFound) {
+		return nil, err
+	}
+
+	// Unknown emails still pay for a bcrypt comparison so that response
+	// timing does not reveal which addresses are registered.
+	// Accounts created through an identity provider have no password.
+	var hash []byte
+	if user != nil && user.Password != "" {
+		hash = []byte(user.Password)
+	}
+
+	if !uc.passwords.Compare(hash, password) {
+		locked, ferr := uc.throttle.Fail(email, client.IP, now)
+		if ferr != nil {
+			return nil, ferr
+		}
+		if locked {
+			uc.events.Publish(entities.SecurityEvent{
+				Type:       entities.SecurityEventLoginLockout,
+				Detail:     "login locked for " + email + " from " + client.IP,
+				OccurredAt: now,
+			})
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := uc.throttle.Succeed(email); err != nil {
+		return nil, err
+	}
+
+	return uc.completeLogin(user, client)
+}
+
+// completeLogin finishes a successful first factor: accounts with two-factor
+// authentication get an MFA challenge, all others a new token family.
+func (uc *AuthUseCase) completeLogin(user *entities.User, client entities.ClientInfo) (*LoginResult, error) {
+	if user.MFAEnabled() {
+		challenge, err := uc.token.GenerateMFAChallenge(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{MFAChallenge: challenge}, nil
+	}
+
+	// Every login starts a new token family
+	access, refresh, err := uc.issueTokens(user, randomToken(16), nil, client)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{AccessToken: access, RefreshToken: refresh}, nil
+}
+
+// StartSession issues tokens in a new family for an already authenticated
+// user, for flows that do not go through Login.
+func (uc *AuthUseCase) StartSession(userID uint, client entities.ClientInfo) (string, string, error) {
+	user, err := uc.repo.FindByID(userID)
+	if err != nil {
+		return "", "", err
+	}
+	return uc.issueTokens(user, randomToken(16), nil, client)
+}
+
+func (uc *AuthUseCase) Refresh(refreshToken string, client entities.ClientInfo) (string, string, error) {
+	rt, err := uc.refreshRepo.FindByToken(refreshToken)
+	if err != nil {
+		return "", "", ErrRefreshTokenInvalid
+	}
+
+	if rt.Revoked {
+		if rt.Rotated {
+			// A token that was already exchanged is being replayed
+			uc.revokeFamily(rt, "rotated refresh token presented again")
+			return "", "", ErrRefreshTokenReused
+		}
+		return "", "", ErrRefreshTokenRevoked
+	}
 
+	if time.Now().After(rt.ExpiresAt) {
+		_ = uc.refreshRepo.Revoke(refreshToken)
+		return "", "", ErrRefreshTokenExpired
+	}
+
+	// Only one caller can rotate a given token; whoever loses the race is
+	// presenting a token that has just been exchanged.
+	rotated, err := uc.refreshRepo.MarkRotated(refreshToken)
 	if err != nil {
 		return "", "", err
 	}
+	if !rotated {
+		uc.revokeFamily(rt, "concurrent rotation of the same refresh token")
+		return "", "", ErrRefreshTokenReused
+	}
 
-	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
-		return "", "", errors.New("invalid credentials")
+	user, err := uc.repo.FindByID(rt.UserID)
+	if err != nil {
+		return "", "", ErrRefreshTokenInvalid
 	}
 
-	access, err := uc.token.GenerateAccessToken(user.ID)
+	return uc.issueTokens(user, rt.FamilyID, &rt.ID, client)
+}
+
+// issueTokens generates an access/refresh pair and stores the refresh token
+// as a member of the given family.
+func (uc *AuthUseCase) issueTokens(user *entities.User, familyID string, parentID *uint, client entities.ClientInfo) (string, string, error) {
+	access, err := uc.token.GenerateAccessToken(user.ID, user.TokenVersion, user.Role, familyID)
 	if err != nil {
 		return "", "", err
 	}
 
-	// 4️⃣ Generate refresh token
 	refresh, err := uc.token.GenerateRefreshToken(user.ID)
 	if err != nil {
 		return "", "", err
@@ -68,7 +237,11 @@ func (uc *AuthUseCase) Login(email, password string) (string, string, error) {
 	if err := uc.refreshRepo.Create(&entities.RefreshToken{
 		UserID:    user.ID,
 		Token:     refresh,
-		ExpiresAt: time.Now().Add(7 * 24 * time.Hour),
+		FamilyID:  familyID,
+		ParentID:  parentID,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
 	}); err != nil {
 		return "", "", err
 	}
@@ -76,42 +249,141 @@ func (uc *AuthUseCase) Login(email, password string) (string, string, error) {
 	return access, refresh, nil
 }
 
-func (uc *AuthUseCase) Refresh(refreshToken string) (string, string, error) {
-	rt, err := uc.refreshRepo.FindByToken(refreshToken)
+func (uc *AuthUseCase) revokeFamily(rt *entities.RefreshToken, detail string) {
+	var err error
+	if rt.FamilyID == "" {
+		// Tokens issued before families existed cannot be grouped
+		err = uc.refreshRepo.RevokeAllForUser(rt.UserID)
+	} else {
+		err = uc.refreshRepo.RevokeFamily(rt.FamilyID)
+	}
 	if err != nil {
-		return "", "", errors.New("invalid refresh token")
+		detail += ": failed to revoke family: " + err.Error()
 	}
 
-	if rt.Revoked {
-		return "", "", errors.New("refresh token revoked")
+	uc.events.Publish(entities.SecurityEvent{
+		Type:       entities.SecurityEventRefreshTokenReuse,
+		UserID:     rt.UserID,
+		FamilyID:   rt.FamilyID,
+		Detail:     detail,
+		OccurredAt: time.Now(),
+	})
+}
+
+// Logout revokes the family of the presented refresh token if it belongs to
+// the caller.
+func (uc *AuthUseCase) Logout(userID uint, refreshToken string) error {
+	if refreshToken == "" {
+		return nil
 	}
 
-	if time.Now().After(rt.ExpiresAt) {
-		_ = uc.refreshRepo.Revoke(refreshToken)
-		return "", "", errors.New("refresh token expired")
+	rt, err := uc.refreshRepo.FindByToken(refreshToken)
+	if err != nil || rt.UserID != userID {
+		// Unknown or foreign tokens are ignored; there is nothing to revoke.
+		return nil
 	}
 
-	if err := uc.refreshRepo.Revoke(refreshToken); err != nil {
-		return "", "", err
+	if rt.FamilyID == "" {
+		return uc.refreshRepo.Revoke(refreshToken)
 	}
+	return uc.refreshRepo.RevokeFamily(rt.FamilyID)
+}
 
-	newAccess, err := uc.token.GenerateAccessToken(rt.UserID)
+// Sessions lists the user's signed-in devices, flagging the one identified
+// by currentSessionID.
+func (uc *AuthUseCase) Sessions(userID uint, currentSessionID string) ([]*entities.Session, error) {
+	sessions, err := uc.refreshRepo.ListSessions(userID, time.Now())
 	if err != nil {
-		return "", "", err
+		return nil, err
+	}
+	for _, s := range sessions {
+		s.Current = currentSessionID != "" && s.FamilyID == currentSessionID
 	}
+	return sessions, nil
+}
 
-	newRefresh, err := uc.token.GenerateRefreshToken(rt.UserID)
+// RevokeSession signs one of the user's devices out. The id may be any token
+// of the family, so a listing that went stale through a refresh still works.
+// Access tokens already issued to the device expire on their own.
+func (uc *AuthUseCase) RevokeSession(userID, id uint) error {
+	rt, err := uc.refreshRepo.FindByID(id)
 	if err != nil {
-		return "", "", err
+		return err
+	}
+	if rt.UserID != userID {
+		return entities.ErrSessionNotFound
 	}
 
-	if err := uc.refreshRepo.Create(&entities.RefreshToken{
-		UserID:    rt.UserID,
-		Token:     newRefresh,
-		ExpiresAt: time.Now().Add(7 * 24 * time.Hour),
-	}); err != nil {
-		return "", "", err
+	if rt.FamilyID == "" {
+		return uc.refreshRepo.RevokeByID(rt.ID)
+	}
+	return uc.refreshRepo.RevokeFamily(rt.FamilyID)
+}
+
+// LogoutAll revokes every refresh token of the user and bumps the token
+// version so that outstanding access tokens are rejected by Authenticate.
+func (uc *AuthUseCase) LogoutAll(userID uint) error {
+	if err := uc.refreshRepo.RevokeAllForUser(userID); err != nil {
+		return err
+	}
+	return uc.repo.IncrementTokenVersion(userID)
+}
+
+// Authenticate validates an access token and checks it against the user's
+// current token version.
+func (uc *AuthUseCase) Authenticate(accessToken string) (*entities.Principal, error) {
+	claims, err := uc.token.ValidateAccessToken(accessToken)
+	if err != nil {
+		return nil, ErrInvalidAccessToken
+	}
+
+	principal, version, ok := principalFromClaims(claims)
+	if !ok {
+		return nil, ErrInvalidAccessToken
 	}
 
-	return newAccess, newRefresh, nil
+	user, err := uc.repo.FindByID(principal.UserID)
+	if err != nil || user.TokenVersion != version {
+		return nil, ErrSessionRevoked
+	}
+	principal.Verified = user.Verified()
+	if principal.Role == "" {
+		// Tokens issued before roles existed carry no role claim
+		principal.Role = user.Role
+	}
+
+	return principal, nil
+}
+
+func principalFromClaims(claims jwt.MapClaims) (*entities.Principal, uint, bool) {
+	// JSON numbers are decoded as float64
+	userID, ok := claims["user_id"].(float64)
+	if !ok || userID <= 0 {
+		return nil, 0, false
+	}
+
+	version, _ := claims["ver"].(float64)
+	tokenID, _ := claims["jti"].(string)
+	role, _ := claims["role"].(string)
+	sessionID, _ := claims["sid"].(string)
+
+	var issuedAt time.Time
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		issuedAt = iat.Time
+	}
+
+	return &entities.Principal{
+		UserID:    uint(userID),
+		TokenID:   tokenID,
+		IssuedAt:  issuedAt,
+		SessionID: sessionID,
+		Role:      entities.Role(role),
+	}, uint(version), true
+}
+
+// randomToken returns n random bytes encoded for use in URLs.
+func randomToken(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
 }
@@ -0,0 +1,198 @@
+package use_cases_test
+
+import (
+	"errors"
+	"hole/entities"
+	"hole/use_cases"
+	"sync"
+	"testing"
+)
+
+type authFixture struct {
+	uc     *use_cases.AuthUseCase
+	tokens *fakeRefreshTokens
+	events *fakeEvents
+}
+
+func newAuthFixture(refreshRepo use_cases.RefreshTokenRepository, tokens *fakeRefreshTokens) *authFixture {
+	events := &fakeEvents{}
+	users := newFakeUsers(&entities.User{ID: 1, Email: "ada@example.com", Role: entities.RoleViewer})
+	uc := use_cases.NewAuthUseCase(users, refreshRepo, &fakeTokens{}, events, nil, nil, nil)
+	return &authFixture{uc: uc, tokens: tokens, events: events}
+}
+
+func (f *authFixture) startSession(t *testing.T) (refresh, familyID string) {
+	t.Helper()
+	_, refresh, err := f.uc.StartSession(1, entities.ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt, err := f.tokens.FindByToken(refresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return refresh, rt.FamilyID
+}
+
+func TestAuthUseCaseRefreshRotates(t *testing.T) {
+	tokens := newFakeRefreshTokens()
+	f := newAuthFixture(tokens, tokens)
+	first, family := f.startSession(t)
+
+	_, second, err := f.uc.Refresh(first, entities.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	old, _ := tokens.FindByToken(first)
+	if !old.Revoked || !old.Rotated {
+		t.Errorf("rotated token: revoked=%v rotated=%v, want both", old.Revoked, old.Rotated)
+	}
+	next, _ := tokens.FindByToken(second)
+	if next.FamilyID != family || next.ParentID == nil || *next.ParentID != old.ID {
+		t.Errorf("new token family=%q parent=%v, want family %q parent %d", next.FamilyID, next.ParentID, family, old.ID)
+	}
+	if n := tokens.active(family); n != 1 {
+		t.Errorf("active tokens in family = %d, want 1", n)
+	}
+}
+
+func TestAuthUseCaseRefreshReuseRevokesFamily(t *testing.T) {
+	tokens := newFakeRefreshTokens()
+	f := newAuthFixture(tokens, tokens)
+	stolen, family := f.startSession(t)
+
+	// The legitimate client rotates twice; the attacker then replays the
+	// token it stole before the first rotation.
+	_, second, err := f.uc.Refresh(stolen, entities.ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, third, err := f.uc.Refresh(second, entities.ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := f.uc.Refresh(stolen, entities.ClientInfo{}); !errors.Is(err, use_cases.ErrRefreshTokenReused) {
+		t.Fatalf("replayed token: err = %v, want ErrRefreshTokenReused", err)
+	}
+	if n := tokens.active(family); n != 0 {
+		t.Errorf("active tokens in family = %d, want 0", n)
+	}
+	if _, _, err := f.uc.Refresh(third, entities.ClientInfo{}); err == nil {
+		t.Error("latest token of a revoked family still refreshes")
+	}
+	if n := f.events.count(entities.SecurityEventRefreshTokenReuse); n != 1 {
+		t.Errorf("reuse events = %d, want 1", n)
+	}
+}
+
+func TestAuthUseCaseRefreshReuseKeepsOtherFamilies(t *testing.T) {
+	tokens := newFakeRefreshTokens()
+	f := newAuthFixture(tokens, tokens)
+	stolen, _ := f.startSession(t)
+	other, otherFamily := f.startSession(t)
+
+	if _, _, err := f.uc.Refresh(stolen, entities.ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.uc.Refresh(stolen, entities.ClientInfo{}); !errors.Is(err, use_cases.ErrRefreshTokenReused) {
+		t.Fatalf("err = %v, want ErrRefreshTokenReused", err)
+	}
+
+	if n := tokens.active(otherFamily); n != 1 {
+		t.Errorf("active tokens in other family = %d, want 1", n)
+	}
+	if _, _, err := f.uc.Refresh(other, entities.ClientInfo{}); err != nil {
+		t.Errorf("other session: %v", err)
+	}
+}
+
+func TestAuthUseCaseRefreshRevokedWithoutRotation(t *testing.T) {
+	tokens := newFakeRefreshTokens()
+	f := newAuthFixture(tokens, tokens)
+	refresh, _ := f.startSession(t)
+	if err := f.uc.Logout(1, refresh); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := f.uc.Refresh(refresh, entities.ClientInfo{}); !errors.Is(err, use_cases.ErrRefreshTokenRevoked) {
+		t.Fatalf("err = %v, want ErrRefreshTokenRevoked", err)
+	}
+	if n := f.events.count(entities.SecurityEventRefreshTokenReuse); n != 0 {
+		t.Errorf("reuse events = %d, want 0 for a logged out session", n)
+	}
+}
+
+// staleReads returns rows as they were before any rotation, as a read that
+// raced with a concurrent rotation would.
+type staleReads struct {
+	*fakeRefreshTokens
+	snapshot map[string]entities.RefreshToken
+}
+
+func (r *staleReads) FindByToken(token string) (*entities.RefreshToken, error) {
+	if t, ok := r.snapshot[token]; ok {
+		return &t, nil
+	}
+	return r.fakeRefreshTokens.FindByToken(token)
+}
+
+func TestAuthUseCaseRefreshLosingRotationRace(t *testing.T) {
+	tokens := newFakeRefreshTokens()
+	winner := newAuthFixture(tokens, tokens)
+	refresh, family := winner.startSession(t)
+
+	row, _ := tokens.FindByToken(refresh)
+	stale := &staleReads{fakeRefreshTokens: tokens, snapshot: map[string]entities.RefreshToken{refresh: *row}}
+	loser := newAuthFixture(stale, tokens)
+
+	if _, _, err := winner.uc.Refresh(refresh, entities.ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	// The loser read the token as active, but MarkRotated no longer
+	// changes it
+	if _, _, err := loser.uc.Refresh(refresh, entities.ClientInfo{}); !errors.Is(err, use_cases.ErrRefreshTokenReused) {
+		t.Fatalf("err = %v, want ErrRefreshTokenReused", err)
+	}
+	if n := tokens.active(family); n != 0 {
+		t.Errorf("active tokens in family = %d, want 0", n)
+	}
+	if n := loser.events.count(entities.SecurityEventRefreshTokenReuse); n != 1 {
+		t.Errorf("reuse events = %d, want 1", n)
+	}
+}
+
+func TestAuthUseCaseRefreshConcurrent(t *testing.T) {
+	tokens := newFakeRefreshTokens()
+	f := newAuthFixture(tokens, tokens)
+	refresh, _ := f.startSession(t)
+
+	const clients = 8
+	errs := make([]error, clients)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, errs[i] = f.uc.Refresh(refresh, entities.ClientInfo{})
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, use_cases.ErrRefreshTokenReused):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d rotations succeeded, want exactly 1", succeeded)
+	}
+	if n := f.events.count(entities.SecurityEventRefreshTokenReuse); n != clients-1 {
+		t.Errorf("reuse events = %d, want %d", n, clients-1)
+	}
+}
@@ -0,0 +1,142 @@
+package use_cases
+
+import (
+	"errors"
+	"hole/entities"
+	"regexp"
+	"strings"
+)
+
+const maxCategoryNameLength = 100
+
+var (
+	ErrInvalidCategory  = errors.New("category name is required and slug must be lower-case letters, digits and single hyphens")
+	ErrCategoryCycle    = errors.New("a category cannot be moved below itself")
+	ErrCategoryNotEmpty = errors.New("category still has subcategories or items")
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+type CategoryRepository interface {
+	Create(category *entities.Category) error
+	FindByID(id uint) (*entities.Category, error)
+	List() ([]*entities.Category, error)
+	Update(category *entities.Category) error
+	Delete(id uint) error
+	SubtreeIDs(id uint) ([]uint, error)
+	InUse(id uint) (bool, error)
+}
+
+type CategoryUseCase struct {
+	repo CategoryRepository
+}
+
+func NewCategoryUseCase(repo CategoryRepository) *CategoryUseCase {
+	return &CategoryUseCase{repo: repo}
+}
+
+func (uc *CategoryUseCase) List() ([]*entities.Category, error) {
+	return uc.repo.List()
+}
+
+func (uc *CategoryUseCase) Get(id uint) (*entities.Category, error) {
+	return uc.repo.FindByID(id)
+}
+
+// Create adds a category below parentID, or at the root when it is nil. An
+// empty slug is derived from the name.
+func (uc *CategoryUseCase) Create(name, slug string, parentID *uint) (*entities.Category, error) {
+	category, err := newCategory(name, slug, parentID)
+	if err != nil {
+		return nil, err
+	}
+	if parentID != nil {
+		if _, err := uc.repo.FindByID(*parentID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := uc.repo.Create(category); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// Update replaces the name, slug and parent of a category. Moving a
+// category moves its whole subtree.
+func (uc *CategoryUseCase) Update(id uint, name, slug string, parentID *uint) (*entities.Category, error) {
+	category, err := newCategory(name, slug, parentID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := uc.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	category.ID = existing.ID
+	category.CreatedAt = existing.CreatedAt
+
+	if parentID != nil {
+		if _, err := uc.repo.FindByID(*parentID); err != nil {
+			return nil, err
+		}
+		subtree, err := uc.repo.SubtreeIDs(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, descendant := range subtree {
+			if descendant == *parentID {
+				return nil, ErrCategoryCycle
+			}
+		}
+	}
+
+	if err := uc.repo.Update(category); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// Delete removes an empty category; subcategories and items must be moved
+// or removed first.
+func (uc *CategoryUseCase) Delete(id uint) error {
+	used, err := uc.repo.InUse(id)
+	if err != nil {
+		return err
+	}
+	if used {
+		return ErrCategoryNotEmpty
+	}
+	return uc.repo.Delete(id)
+}
+
+func newCategory(name, slug string, parentID *uint) (*entities.Category, error) {
+	name = strings.TrimSpace(name)
+	if slug == "" {
+		slug = slugify(name)
+	}
+	if name == "" || len(name) > maxCategoryNameLength || !slugPattern.MatchString(slug) {
+		return nil, ErrInvalidCategory
+	}
+	return &entities.Category{Name: name, Slug: slug, ParentID: parentID}, nil
+}
+
+// slugify lower-cases a name and joins its ASCII letters and digits with
+// hyphens.
+func slugify(name string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+	return b.String()
+}
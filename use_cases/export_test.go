@@ -0,0 +1,13 @@
+package use_cases
+
+import "time"
+
+// TOTPCode returns the code of a base32 secret at the given time, for tests
+// acting as the authenticator app.
+func TOTPCode(encodedSecret string, at time.Time) string {
+	secret, err := totpEncoding.DecodeString(encodedSecret)
+	if err != nil {
+		panic(err)
+	}
+	return totpCode(secret, totpStep(at))
+}
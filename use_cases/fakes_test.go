@@ -0,0 +1,563 @@
+package use_cases_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hole/entities"
+	"hole/use_cases"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeUsers is an in-memory UserRepository.
+type fakeUsers struct {
+	mu    sync.Mutex
+	users map[uint]*entities.User
+}
+
+func newFakeUsers(users ...*entities.User) *fakeUsers {
+	r := &fakeUsers{users: map[uint]*entities.User{}}
+	for _, u := range users {
+		r.users[u.ID] = u
+	}
+	return r
+}
+
+func (r *fakeUsers) Create(user *entities.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if u.Email == user.Email {
+			return entities.ErrEmailTaken
+		}
+	}
+	user.ID = uint(len(r.users) + 1)
+	r.users[user.ID] = user
+	return nil
+}
+
+func (r *fakeUsers) FindByEmail(email string) (*entities.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if u.Email == email {
+			copy := *u
+			return &copy, nil
+		}
+	}
+	return nil, entities.ErrUserNotFound
+}
+
+func (r *fakeUsers) FindByID(id uint) (*entities.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return nil, entities.ErrUserNotFound
+	}
+	copy := *u
+	return &copy, nil
+}
+
+func (r *fakeUsers) update(id uint, f func(u *entities.User)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return entities.ErrUserNotFound
+	}
+	f(u)
+	return nil
+}
+
+func (r *fakeUsers) IncrementTokenVersion(id uint) error {
+	return r.update(id, func(u *entities.User) { u.TokenVersion++ })
+}
+
+func (r *fakeUsers) MarkVerified(id uint, at time.Time) error {
+	return r.update(id, func(u *entities.User) { u.VerifiedAt = &at })
+}
+
+func (r *fakeUsers) UpdatePassword(id uint, hash string) error {
+	return r.update(id, func(u *entities.User) { u.Password = hash })
+}
+
+func (r *fakeUsers) UpdateDisplayName(id uint, name string) error {
+	return r.update(id, func(u *entities.User) { u.DisplayName = name })
+}
+
+func (r *fakeUsers) UpdateEmail(id uint, email string, verifiedAt time.Time) error {
+	return r.update(id, func(u *entities.User) { u.Email, u.VerifiedAt = email, &verifiedAt })
+}
+
+func (r *fakeUsers) UpdateRole(id uint, role entities.Role) error {
+	return r.update(id, func(u *entities.User) { u.Role = role })
+}
+
+// fakeRefreshTokens is an in-memory RefreshTokenRepository keyed by the raw
+// token. Like the Postgres repository, it hands out copies of its rows.
+type fakeRefreshTokens struct {
+	mu     sync.Mutex
+	tokens map[string]*entities.RefreshToken
+	nextID uint
+}
+
+func newFakeRefreshTokens() *fakeRefreshTokens {
+	return &fakeRefreshTokens{tokens: map[string]*entities.RefreshToken{}}
+}
+
+func (r *fakeRefreshTokens) Create(t *entities.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	row := *t
+	row.ID = r.nextID
+	row.CreatedAt = time.Now()
+	r.tokens[t.Token] = &row
+	t.ID = row.ID
+	return nil
+}
+
+func (r *fakeRefreshTokens) FindByToken(token string) (*entities.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tokens[token]
+	if !ok {
+		return nil, entities.ErrSessionNotFound
+	}
+	copy := *t
+	return &copy, nil
+}
+
+func (r *fakeRefreshTokens) FindByID(id uint) (*entities.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, t := range r.tokens {
+		if t.ID == id {
+			copy := *t
+			return &copy, nil
+		}
+	}
+	return nil, entities.ErrSessionNotFound
+}
+
+func (r *fakeRefreshTokens) Revoke(token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if t, ok := r.tokens[token]; ok {
+		t.Revoked = true
+	}
+	return nil
+}
+
+func (r *fakeRefreshTokens) RevokeByID(id uint) error {
+	return r.revokeWhere(func(t *entities.RefreshToken) bool { return t.ID == id })
+}
+
+func (r *fakeRefreshTokens) RevokeAllForUser(userID uint) error {
+	return r.revokeWhere(func(t *entities.RefreshToken) bool { return t.UserID == userID })
+}
+
+func (r *fakeRefreshTokens) RevokeFamily(familyID string) error {
+	return r.revokeWhere(func(t *entities.RefreshToken) bool { return t.FamilyID == familyID })
+}
+
+func (r *fakeRefreshTokens) revokeWhere(match func(t *entities.RefreshToken) bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, t := range r.tokens {
+		if match(t) {
+			t.Revoked = true
+		}
+	}
+	return nil
+}
+
+// MarkRotated only changes active tokens, like the conditional UPDATE of the
+// Postgres repository.
+func (r *fakeRefreshTokens) MarkRotated(token string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tokens[token]
+	if !ok || t.Revoked {
+		return false, nil
+	}
+	now := time.Now()
+	t.Revoked, t.Rotated, t.LastUsedAt = true, true, &now
+	return true, nil
+}
+
+func (r *fakeRefreshTokens) ListSessions(userID uint, now time.Time) ([]*entities.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var sessions []*entities.Session
+	for _, t := range r.tokens {
+		if t.UserID == userID && !t.Revoked && t.ExpiresAt.After(now) {
+			sessions = append(sessions, &entities.Session{ID: t.ID, FamilyID: t.FamilyID, ExpiresAt: t.ExpiresAt})
+		}
+	}
+	return sessions, nil
+}
+
+// active counts the tokens of a family that are not revoked.
+func (r *fakeRefreshTokens) active(familyID string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for _, t := range r.tokens {
+		if t.FamilyID == familyID && !t.Revoked {
+			n++
+		}
+	}
+	return n
+}
+
+// fakeEvents records published security events.
+type fakeEvents struct {
+	mu     sync.Mutex
+	events []entities.SecurityEvent
+}
+
+func (p *fakeEvents) Publish(event entities.SecurityEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.events = append(p.events, event)
+}
+
+func (p *fakeEvents) count(eventType string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := 0
+	for _, e := range p.events {
+		if e.Type == eventType {
+			n++
+		}
+	}
+	return n
+}
+
+// fakeTokens issues opaque, unique tokens instead of signed JWTs.
+type fakeTokens struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (s *fakeTokens) next(kind string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.n++
+	return fmt.Sprintf("%s.%d", kind, s.n)
+}
+
+func (s *fakeTokens) GenerateAccessToken(userID, tokenVersion uint, role entities.Role, sessionID string) (string, error) {
+	return s.next("access"), nil
+}
+
+func (s *fakeTokens) GenerateRefreshToken(userID uint) (string, error) {
+	return s.next("refresh"), nil
+}
+
+func (s *fakeTokens) ValidateAccessToken(token string) (jwt.MapClaims, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func (s *fakeTokens) GenerateMFAChallenge(userID uint) (string, error) {
+	return fmt.Sprintf("mfa.%d", userID), nil
+}
+
+func (s *fakeTokens) ValidateMFAChallenge(token string) (uint, error) {
+	var userID uint
+	if _, err := fmt.Sscanf(token, "mfa.%d", &userID); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// fakeOneTimeTokens is an in-memory OneTimeTokenRepository keyed by the raw
+// token.
+type fakeOneTimeTokens struct {
+	mu     sync.Mutex
+	tokens map[string]*entities.OneTimeToken
+	nextID uint
+}
+
+func newFakeOneTimeTokens() *fakeOneTimeTokens {
+	return &fakeOneTimeTokens{tokens: map[string]*entities.OneTimeToken{}}
+}
+
+func (r *fakeOneTimeTokens) Create(t *entities.OneTimeToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	row := *t
+	row.ID = r.nextID
+	row.CreatedAt = time.Now()
+	r.tokens[t.Token] = &row
+	return nil
+}
+
+func (r *fakeOneTimeTokens) Consume(purpose, token string, now time.Time) (*entities.OneTimeToken, error) {
+	return r.ConsumeBound(purpose, token, "", now)
+}
+
+func (r *fakeOneTimeTokens) ConsumeBound(purpose, token, binding string, now time.Time) (*entities.OneTimeToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tokens[token]
+	if !ok || t.Purpose != purpose || t.Binding != binding || t.UsedAt != nil || !t.ExpiresAt.After(now) {
+		return nil, entities.ErrInvalidToken
+	}
+	t.UsedAt = &now
+	copy := *t
+	return &copy, nil
+}
+
+func (r *fakeOneTimeTokens) Latest(userID uint, purpose string) (*entities.OneTimeToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var latest *entities.OneTimeToken
+	for _, t := range r.tokens {
+		if t.UserID == userID && t.Purpose == purpose && (latest == nil || t.ID > latest.ID) {
+			latest = t
+		}
+	}
+	if latest == nil {
+		return nil, entities.ErrInvalidToken
+	}
+	copy := *latest
+	return &copy, nil
+}
+
+func (r *fakeOneTimeTokens) InvalidateAll(userID uint, purpose string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, t := range r.tokens {
+		if t.UserID == userID && t.Purpose == purpose && t.UsedAt == nil {
+			t.UsedAt = &now
+		}
+	}
+	return nil
+}
+
+// expire moves the expiry of every token into the past.
+func (r *fakeOneTimeTokens) expire() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, t := range r.tokens {
+		t.ExpiresAt = time.Now().Add(-time.Second)
+	}
+}
+
+// fakeSessions records the users signed out everywhere.
+type fakeSessions struct {
+	loggedOut []uint
+}
+
+func (s *fakeSessions) LogoutAll(userID uint) error {
+	s.loggedOut = append(s.loggedOut, userID)
+	return nil
+}
+
+func (r *fakeUsers) SetTOTPSecret(id uint, secret string) error {
+	return r.update(id, func(u *entities.User) { u.TOTPSecret, u.TOTPEnabledAt, u.TOTPLastStep = secret, nil, 0 })
+}
+
+func (r *fakeUsers) EnableTOTP(id uint, at time.Time) error {
+	return r.update(id, func(u *entities.User) { u.TOTPEnabledAt = &at })
+}
+
+func (r *fakeUsers) DisableTOTP(id uint) error {
+	return r.update(id, func(u *entities.User) { u.TOTPSecret, u.TOTPEnabledAt, u.TOTPLastStep = "", nil, 0 })
+}
+
+func (r *fakeUsers) AdvanceTOTPStep(id uint, step int64) (bool, error) {
+	advanced := false
+	err := r.update(id, func(u *entities.User) {
+		if u.TOTPLastStep < step {
+			u.TOTPLastStep, advanced = step, true
+		}
+	})
+	return advanced, err
+}
+
+// fakeRecoveryCodes is an in-memory RecoveryCodeRepository.
+type fakeRecoveryCodes struct {
+	mu sync.Mutex
+	// codes maps a user to their unused codes.
+	codes map[uint]map[string]bool
+}
+
+func newFakeRecoveryCodes() *fakeRecoveryCodes {
+	return &fakeRecoveryCodes{codes: map[uint]map[string]bool{}}
+}
+
+func (r *fakeRecoveryCodes) Replace(userID uint, codes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.codes[userID] = map[string]bool{}
+	for _, code := range codes {
+		r.codes[userID][code] = true
+	}
+	return nil
+}
+
+func (r *fakeRecoveryCodes) Consume(userID uint, code string, now time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.codes[userID][code] {
+		return false, nil
+	}
+	delete(r.codes[userID], code)
+	return true, nil
+}
+
+func (r *fakeRecoveryCodes) DeleteAll(userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.codes, userID)
+	return nil
+}
+
+// fakeClock is a Clock that only moves when told to.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// fakeOIDCStates is an in-memory OIDCStateRepository keyed by the raw state.
+type fakeOIDCStates struct {
+	mu     sync.Mutex
+	states map[string]entities.OIDCState
+}
+
+func newFakeOIDCStates() *fakeOIDCStates {
+	return &fakeOIDCStates{states: map[string]entities.OIDCState{}}
+}
+
+func (r *fakeOIDCStates) Create(s *entities.OIDCState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.states[s.State] = *s
+	return nil
+}
+
+func (r *fakeOIDCStates) Consume(state string, now time.Time) (*entities.OIDCState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.states[state]
+	delete(r.states, state)
+	if !ok || !now.Before(s.ExpiresAt) {
+		return nil, entities.ErrInvalidToken
+	}
+	return &s, nil
+}
+
+// expire moves the expiry of every pending sign-in into the past.
+func (r *fakeOIDCStates) expire() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, s := range r.states {
+		s.ExpiresAt = time.Now().Add(-time.Second)
+		r.states[key] = s
+	}
+}
+
+// fakeIdentities is an in-memory UserIdentityRepository.
+type fakeIdentities struct {
+	mu         sync.Mutex
+	identities []entities.UserIdentity
+}
+
+func (r *fakeIdentities) Create(identity *entities.UserIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	identity.ID = uint(len(r.identities) + 1)
+	r.identities = append(r.identities, *identity)
+	return nil
+}
+
+func (r *fakeIdentities) FindBySubject(provider, subject string) (*entities.UserIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, entities.ErrIdentityNotFound
+}
+
+// fakeIdentityProvider remembers the nonce and PKCE challenge of the last
+// authorization URL. Exchange checks the verifier against that challenge and
+// asserts identity, carrying the remembered nonce unless one is set.
+type fakeIdentityProvider struct {
+	identity  use_cases.ExternalIdentity
+	err       error
+	nonce     string
+	challenge string
+}
+
+func (p *fakeIdentityProvider) AuthCodeURL(state, nonce, codeChallenge string) (string, error) {
+	p.nonce, p.challenge = nonce, codeChallenge
+	return "https://idp.example.com/authorize?" + url.Values{
+		"state":          {state},
+		"nonce":          {nonce},
+		"code_challenge": {codeChallenge},
+	}.Encode(), nil
+}
+
+func (p *fakeIdentityProvider) Exchange(ctx context.Context, code, codeVerifier string) (*use_cases.ExternalIdentity, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	sum := sha256.Sum256([]byte(codeVerifier))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+		return nil, errors.New("invalid_grant")
+	}
+	identity := p.identity
+	if identity.Nonce == "" {
+		identity.Nonce = p.nonce
+	}
+	return &identity, nil
+}
@@ -0,0 +1,184 @@
+package use_cases_test
+
+import (
+	"errors"
+	"hole/entities"
+	"hole/repository"
+	"hole/use_cases"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newSearchUseCase indexes items in memory for SearchItems; the other
+// repositories are not used by searches.
+func newSearchUseCase(items ...entities.Item) *use_cases.ItemUseCase {
+	search := repository.NewItemSearchRepositoryMemory()
+	for _, item := range items {
+		search.Put(item)
+	}
+	return use_cases.NewItemUseCase(nil, nil, search, nil, nil)
+}
+
+func hitIDs(hits []*entities.ItemSearchHit) []uint {
+	ids := []uint{}
+	for _, hit := range hits {
+		ids = append(ids, hit.ProductID)
+	}
+	return ids
+}
+
+func TestSearchItemsRanking(t *testing.T) {
+	uc := newSearchUseCase(
+		entities.Item{ProductID: 1, ProductName: "Oak table", ProductDesc: "Seats four, next to a desk lamp"},
+		entities.Item{ProductID: 2, ProductName: "Desk lamp", ProductDesc: "Brass lamp with a linen shade"},
+		entities.Item{ProductID: 3, ProductName: "Floor lamp", ProductDesc: "Tall and bright"},
+		entities.Item{ProductID: 4, ProductName: "Lampshade", ProductDesc: "Linen"},
+		entities.Item{ProductID: 5, ProductName: "Rug", ProductDesc: "Wool"},
+	)
+
+	tests := []struct {
+		query string
+		want  []uint
+	}{
+		// Name matches rank above description matches, repeated matches higher
+		{"lamp ", []uint{2, 3, 1}},
+		// Every word must match
+		{"desk lamp ", []uint{2, 1}},
+		{"linen lamp ", []uint{2}},
+		// The last word matches as a prefix while it is being typed
+		{"lamp", []uint{2, 3, 4, 1}},
+		{"LAMPS", []uint{4}},
+		{"lamps ", []uint{}},
+		{"wool rug", []uint{5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			page, err := uc.SearchItems(use_cases.ItemSearchParams{Query: tt.query})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hitIDs(page.Hits); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("hits = %v, want %v", got, tt.want)
+			}
+			if page.TotalEstimate != int64(len(tt.want)) {
+				t.Errorf("TotalEstimate = %d, want %d", page.TotalEstimate, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestSearchItemsSnippet(t *testing.T) {
+	long := "A " + strings.Repeat("plain ", 40) + "brass lamp " + strings.Repeat("filler ", 40)
+
+	tests := []struct {
+		name string
+		item entities.Item
+		want string
+	}{
+		{
+			name: "matches in the description are marked",
+			item: entities.Item{ProductID: 1, ProductName: "Lamp", ProductDesc: "Brass lamp, with a lamp-post base"},
+			want: "Brass <mark>lamp</mark>, with a <mark>lamp</mark>-post base",
+		},
+		{
+			name: "the name stands in for an empty description",
+			item: entities.Item{ProductID: 1, ProductName: "Desk lamp"},
+			want: "Desk <mark>lamp</mark>",
+		},
+		{
+			name: "markup in the text is escaped",
+			item: entities.Item{ProductID: 1, ProductName: "Lamp", ProductDesc: "<b>lamp</b> & shade"},
+			want: "&lt;b&gt;<mark>lamp</mark>&lt;/b&gt; &amp; shade",
+		},
+		{
+			name: "long descriptions are cut around the first match",
+			item: entities.Item{ProductID: 1, ProductName: "Lamp", ProductDesc: long},
+			want: strings.TrimSpace(strings.Repeat("plain ", 9)) + " brass <mark>lamp</mark> " + strings.TrimSpace(strings.Repeat("filler ", 19)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := newSearchUseCase(tt.item)
+			page, err := uc.SearchItems(use_cases.ItemSearchParams{Query: "lamp "})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Hits) != 1 {
+				t.Fatalf("%d hits, want 1", len(page.Hits))
+			}
+			if page.Hits[0].Snippet != tt.want {
+				t.Errorf("snippet = %q\nwant      %q", page.Hits[0].Snippet, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchItemsPrefixSnippet(t *testing.T) {
+	uc := newSearchUseCase(entities.Item{ProductID: 1, ProductName: "Lamp", ProductDesc: "Lamps and lampshades"})
+
+	page, err := uc.SearchItems(use_cases.ItemSearchParams{Query: "lamps lamp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<mark>Lamps</mark> and <mark>lampshades</mark>"; len(page.Hits) != 1 || page.Hits[0].Snippet != want {
+		t.Fatalf("hits = %+v, want one with snippet %q", page.Hits, want)
+	}
+}
+
+func TestSearchItemsPaging(t *testing.T) {
+	var items []entities.Item
+	for id := uint(1); id <= 5; id++ {
+		items = append(items, entities.Item{
+			ProductID:   id,
+			ProductName: "Lamp",
+			Variants:    []entities.Variant{{ID: id, ItemID: id, SKU: "LAMP"}},
+		})
+	}
+	uc := newSearchUseCase(items...)
+
+	page, err := uc.SearchItems(use_cases.ItemSearchParams{Query: "lamp", Limit: 2, Offset: 2, ExcludeVariants: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hitIDs(page.Hits); !reflect.DeepEqual(got, []uint{3, 4}) {
+		t.Errorf("hits = %v, want [3 4]", got)
+	}
+	if page.TotalEstimate != 5 || page.Limit != 2 || page.Offset != 2 {
+		t.Errorf("page = %+v, want 5 in total at limit 2 offset 2", page)
+	}
+	for _, hit := range page.Hits {
+		if hit.Variants != nil {
+			t.Errorf("item %d carries variants", hit.ProductID)
+		}
+	}
+
+	page, err = uc.SearchItems(use_cases.ItemSearchParams{Query: "lamp", Offset: 10})
+	if err != nil || len(page.Hits) != 0 {
+		t.Errorf("past the end: %v hits, err = %v", len(page.Hits), err)
+	}
+}
+
+func TestSearchItemsInvalid(t *testing.T) {
+	uc := newSearchUseCase()
+
+	tests := []struct {
+		name    string
+		params  use_cases.ItemSearchParams
+		wantErr error
+	}{
+		{"no words", use_cases.ItemSearchParams{Query: " -- "}, use_cases.ErrEmptySearch},
+		{"negative offset", use_cases.ItemSearchParams{Query: "lamp", Offset: -1}, use_cases.ErrInvalidPage},
+		{"negative limit", use_cases.ItemSearchParams{Query: "lamp", Limit: -1}, use_cases.ErrInvalidPage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := uc.SearchItems(tt.params); !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,21 +2,137 @@ package use_cases
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"hole/entities"
 	"io"
+	"regexp"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/minio/minio-go/v7"
 )
 
 type ItemRepository interface {
 	Create(item *entities.Item) error
-	FindByOwnerID(ownerID uint) ([]*entities.Item, error)
-	// FindByIDAndOwner(id, ownerID uint) (*entities.Item, error)
-	Update(id uint, name, desc, img string) error
+	FindByID(id uint) (*entities.Item, error)
+	FindByIDAndOwner(id, ownerID uint) (*entities.Item, error)
+	Update(id uint, u entities.ItemUpdate) error
+	ResolveTags(names []string) ([]entities.Tag, error)
 	Delete(id uint) error
-	ListItem() ([]*entities.Item, error)
+	ListPage(q entities.ItemQuery) ([]*entities.Item, error)
+	CountUpTo(filter entities.ItemFilter, limit int) (int64, error)
+}
+
+// ItemSearchRepository is the full-text index over items.
+type ItemSearchRepository interface {
+	Search(q entities.ItemSearchQuery) ([]*entities.ItemSearchHit, error)
+	CountMatches(q entities.ItemSearchQuery, limit int) (int64, error)
+}
+
+const (
+	DefaultItemPageSize = 20
+	MaxItemPageSize     = 100
+	// itemCountCap bounds the work spent on TotalEstimate; larger results
+	// are reported as this value.
+	itemCountCap = 10000
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("sort must be one of id, name or created, optionally prefixed with -")
+	ErrInvalidPage   = errors.New("limit and offset must not be negative, and offset cannot be combined with cursor")
+	ErrEmptySearch   = errors.New("search query must contain at least one word")
+	ErrInvalidTags   = errors.New("tags must be 1 to 50 characters without commas, at most 20 per item")
+
+	ErrInvalidPrice      = errors.New("price must not be negative")
+	ErrInvalidCurrency   = errors.New("currency must be a three-letter ISO 4217 code and is required with a price")
+	ErrInvalidStock      = errors.New("stock must not be negative")
+	ErrInvalidAdjustment = errors.New("delta must be non-zero and at most 1000000 in size, reason one of restock, sale, return, damage or correction, and note at most 200 characters")
+)
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+const (
+	maxStockDelta         = 1000000
+	maxAdjustmentNote     = 200
+	DefaultInventoryLimit = 50
+)
+
+const (
+	maxItemTags  = 20
+	maxTagLength = 50
+)
+
+// maxSearchTerms bounds the size of a search query; further words are
+// ignored.
+const maxSearchTerms = 10
+
+// ItemListParams are the listing options as given by the client.
+type ItemListParams struct {
+	NamePrefix string
+	OwnerID    uint
+	// Category is a category slug; items of its subcategories match too.
+	Category string
+	// Tags must all be carried by an item.
+	Tags []string
+	// Sort is "id", "name" or "created", with a "-" prefix for descending.
+	Sort   string
+	Limit  int
+	Offset int
+	// Cursor is the NextCursor of the previous page.
+	Cursor string
+	// ExcludeVariants leaves the variants out of the items.
+	ExcludeVariants bool
+}
+
+type ItemPage struct {
+	Items      []*entities.Item
+	Limit      int
+	Offset     int
+	NextCursor string
+	// TotalEstimate counts matching items up to a cap.
+	TotalEstimate int64
+}
+
+// ItemFields are the client-supplied attributes of an item. On update,
+// empty fields and nil pointers are left unchanged, a CategoryID of 0
+// removes the category and an empty non-nil Tags removes all tags.
+type ItemFields struct {
+	Name       string
+	Desc       string
+	ImageKey   string
+	CategoryID *uint
+	Tags       []string
+	PriceMinor *int64
+	Currency   string
+	// Stock is the initial stock; it is ignored on update, where stock
+	// only changes through AdjustStock.
+	Stock int
+}
+
+type ItemSearchParams struct {
+	Query           string
+	Limit           int
+	Offset          int
+	ExcludeVariants bool
+}
+
+type ItemSearchPage struct {
+	Hits          []*entities.ItemSearchHit
+	Limit         int
+	Offset        int
+	TotalEstimate int64
+}
+
+// InventoryRepository applies stock adjustments and keeps their ledger.
+type InventoryRepository interface {
+	Adjust(adj *entities.InventoryAdjustment) error
+	History(itemID uint, limit int) ([]*entities.InventoryAdjustment, error)
 }
 
 type FileRepository interface {
@@ -25,37 +141,318 @@ type FileRepository interface {
 }
 
 type ItemUseCase struct {
-	repo     ItemRepository
-	fileRepo FileRepository
+	repo       ItemRepository
+	fileRepo   FileRepository
+	search     ItemSearchRepository
+	categories CategoryRepository
+	inventory  InventoryRepository
 }
 
-func NewItemUseCase(repo ItemRepository, fileRepo FileRepository) *ItemUseCase {
-	return &ItemUseCase{repo: repo, fileRepo: fileRepo}
+func NewItemUseCase(repo ItemRepository, fileRepo FileRepository, search ItemSearchRepository, categories CategoryRepository, inventory InventoryRepository) *ItemUseCase {
+	return &ItemUseCase{repo: repo, fileRepo: fileRepo, search: search, categories: categories, inventory: inventory}
 }
 
-func (uc *ItemUseCase) CreateItem(name, desc string, ctx context.Context, imageKey string) error {
+// CreateItem stores a new item, optionally in a category and with tags;
+// unknown tags are created.
+func (uc *ItemUseCase) CreateItem(ctx context.Context, ownerID uint, f ItemFields) error {
+	if err := uc.checkCategory(f.CategoryID); err != nil {
+		return err
+	}
+	resolved, err := uc.resolveTags(f.Tags)
+	if err != nil {
+		return err
+	}
+	if f.Stock < 0 {
+		return ErrInvalidStock
+	}
+
 	item := &entities.Item{
-		ProductName:     name,
-		ProductDesc:     desc,
-		ProductImageKey: imageKey, // e.g., "products-images/177...jpg"
+		ProductName:     f.Name,
+		ProductDesc:     f.Desc,
+		ProductImageKey: f.ImageKey, // e.g., "products-images/177...jpg"
+		OwnerID:         ownerID,
+		CategoryID:      f.CategoryID,
+		Tags:            resolved,
+		Stock:           f.Stock,
+	}
+	if f.PriceMinor != nil {
+		item.PriceMinor = *f.PriceMinor
+	}
+	if item.Currency, err = checkPrice(f.PriceMinor, f.Currency, ""); err != nil {
+		return err
 	}
 
 	return uc.repo.Create(item)
 }
 
-func (uc *ItemUseCase) GetMyItems(ownerID uint) ([]*entities.Item, error) {
-	return uc.repo.FindByOwnerID(ownerID)
+// ListItems returns one page of items along with the position of the next
+// page and an estimate of the total.
+func (uc *ItemUseCase) ListItems(p ItemListParams) (*ItemPage, error) {
+	q := entities.ItemQuery{
+		Filter: entities.ItemFilter{
+			NamePrefix: p.NamePrefix,
+			OwnerID:    p.OwnerID,
+			Category:   p.Category,
+		},
+		Limit:           p.Limit,
+		Offset:          p.Offset,
+		IncludeVariants: !p.ExcludeVariants,
+	}
+
+	var err error
+	if q.Limit, err = pageSize(q.Limit); err != nil {
+		return nil, err
+	}
+	if q.Filter.Tags, err = normalizeTags(p.Tags); err != nil {
+		return nil, err
+	}
+	if q.Offset < 0 || (q.Offset > 0 && p.Cursor != "") {
+		return nil, ErrInvalidPage
+	}
+
+	sort, desc := strings.CutPrefix(p.Sort, "-")
+	q.Desc = desc
+	switch entities.ItemSortField(sort) {
+	case "", entities.ItemSortID:
+		q.Sort = entities.ItemSortID
+	case entities.ItemSortName, entities.ItemSortCreated:
+		q.Sort = entities.ItemSortField(sort)
+	default:
+		return nil, ErrInvalidSort
+	}
+
+	if p.Cursor != "" {
+		after, err := decodeItemCursor(p.Cursor, q.Sort, q.Desc)
+		if err != nil {
+			return nil, err
+		}
+		q.After = after
+	}
+
+	// One extra row tells whether another page follows
+	limit := q.Limit
+	q.Limit++
+	items, err := uc.repo.ListPage(q)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ItemPage{Items: items, Limit: limit, Offset: q.Offset}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		last := page.Items[limit-1]
+		page.NextCursor = encodeItemCursor(q.Sort, q.Desc, last)
+	}
+
+	page.TotalEstimate, err = uc.repo.CountUpTo(q.Filter, itemCountCap)
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// SearchItems runs a full-text search over item names and descriptions,
+// best matches first. The last word of the query also matches longer words
+// unless it is followed by a space, which suits search-as-you-type.
+func (uc *ItemUseCase) SearchItems(p ItemSearchParams) (*ItemSearchPage, error) {
+	limit, err := pageSize(p.Limit)
+	if err != nil {
+		return nil, err
+	}
+	if p.Offset < 0 {
+		return nil, ErrInvalidPage
+	}
+
+	terms := entities.SearchTerms(p.Query)
+	if len(terms) == 0 {
+		return nil, ErrEmptySearch
+	}
+	prefix := true
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	} else {
+		last, _ := utf8.DecodeLastRuneInString(p.Query)
+		prefix = unicode.IsLetter(last) || unicode.IsDigit(last)
+	}
+
+	q := entities.ItemSearchQuery{
+		Terms:           terms,
+		Prefix:          prefix,
+		Limit:           limit,
+		Offset:          p.Offset,
+		IncludeVariants: !p.ExcludeVariants,
+	}
+	hits, err := uc.search.Search(q)
+	if err != nil {
+		return nil, err
+	}
+	total, err := uc.search.CountMatches(q, itemCountCap)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ItemSearchPage{Hits: hits, Limit: limit, Offset: p.Offset, TotalEstimate: total}, nil
+}
+
+// pageSize applies the default and maximum to a requested page size.
+func pageSize(limit int) (int, error) {
+	switch {
+	case limit == 0:
+		return DefaultItemPageSize, nil
+	case limit < 0:
+		return 0, ErrInvalidPage
+	case limit > MaxItemPageSize:
+		return MaxItemPageSize, nil
+	}
+	return limit, nil
+}
+
+// UpdateItem changes an item as described on ItemFields.
+func (uc *ItemUseCase) UpdateItem(ownerID, id uint, f ItemFields) error {
+	item, err := uc.repo.FindByIDAndOwner(id, ownerID)
+	if err != nil {
+		return err
+	}
+	if f.CategoryID != nil && *f.CategoryID != 0 {
+		if err := uc.checkCategory(f.CategoryID); err != nil {
+			return err
+		}
+	}
+
+	u := entities.ItemUpdate{
+		Name:       f.Name,
+		Desc:       f.Desc,
+		ImageKey:   f.ImageKey,
+		CategoryID: f.CategoryID,
+		PriceMinor: f.PriceMinor,
+	}
+	if f.Tags != nil {
+		if u.Tags, err = uc.resolveTags(f.Tags); err != nil {
+			return err
+		}
+	}
+	if f.PriceMinor != nil || f.Currency != "" {
+		if u.Currency, err = checkPrice(f.PriceMinor, f.Currency, item.Currency); err != nil {
+			return err
+		}
+	}
+	return uc.repo.Update(id, u)
+}
+
+// checkPrice validates a price and returns its normalized currency, which
+// defaults to current.
+func checkPrice(priceMinor *int64, currency, current string) (string, error) {
+	if priceMinor != nil && *priceMinor < 0 {
+		return "", ErrInvalidPrice
+	}
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		currency = current
+	}
+	if currency == "" && priceMinor == nil {
+		return "", nil
+	}
+	if !currencyPattern.MatchString(currency) {
+		return "", ErrInvalidCurrency
+	}
+	return currency, nil
+}
+
+// AdjustStock changes the stock of an item, or of one of its variants when
+// variantID is set, and records the change in the ledger of the item. The
+// item owner and admins may adjust stock; stock never drops below zero.
+func (uc *ItemUseCase) AdjustStock(actorID uint, role entities.Role, itemID uint, variantID *uint, delta int, reason entities.InventoryReason, note string) (*entities.InventoryAdjustment, error) {
+	note = strings.TrimSpace(note)
+	if delta == 0 || delta > maxStockDelta || delta < -maxStockDelta ||
+		!reason.Valid() || len(note) > maxAdjustmentNote {
+		return nil, ErrInvalidAdjustment
+	}
+	if _, err := authorizeItem(uc.repo, actorID, role, itemID); err != nil {
+		return nil, err
+	}
+
+	adj := &entities.InventoryAdjustment{
+		ItemID:    itemID,
+		VariantID: variantID,
+		Delta:     delta,
+		Reason:    reason,
+		Note:      note,
+		ActorID:   actorID,
+	}
+	if err := uc.inventory.Adjust(adj); err != nil {
+		return nil, err
+	}
+	return adj, nil
+}
+
+// InventoryHistory returns the latest stock adjustments of an item, newest
+// first, to its owner and admins.
+func (uc *ItemUseCase) InventoryHistory(actorID uint, role entities.Role, itemID uint, limit int) ([]*entities.InventoryAdjustment, error) {
+	if limit == 0 {
+		limit = DefaultInventoryLimit
+	}
+	limit, err := pageSize(limit)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := authorizeItem(uc.repo, actorID, role, itemID); err != nil {
+		return nil, err
+	}
+	return uc.inventory.History(itemID, limit)
 }
 
-func (uc *ItemUseCase) GetAllItems() ([]*entities.Item, error) {
-	return uc.repo.ListItem()
+// authorizeItem returns an item for its owner, and for admins, to manage.
+func authorizeItem(repo ItemRepository, userID uint, role entities.Role, itemID uint) (*entities.Item, error) {
+	item, err := repo.FindByIDAndOwner(itemID, userID)
+	if errors.Is(err, entities.ErrItemForbidden) && role.Includes(entities.RoleAdmin) {
+		return repo.FindByID(itemID)
+	}
+	return item, err
 }
 
-func (uc *ItemUseCase) UpdateItem(id uint, name, desc, img string) error {
-	return uc.repo.Update(id, name, desc, img)
+func (uc *ItemUseCase) checkCategory(categoryID *uint) error {
+	if categoryID == nil {
+		return nil
+	}
+	_, err := uc.categories.FindByID(*categoryID)
+	return err
+}
+
+func (uc *ItemUseCase) resolveTags(tags []string) ([]entities.Tag, error) {
+	names, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	return uc.repo.ResolveTags(names)
+}
+
+// normalizeTags trims and lower-cases tag names and drops duplicates.
+func normalizeTags(tags []string) ([]string, error) {
+	names := make([]string, 0, len(tags))
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		name := strings.ToLower(strings.TrimSpace(tag))
+		if name == "" || len(name) > maxTagLength || strings.Contains(name, ",") {
+			return nil, ErrInvalidTags
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	if len(names) > maxItemTags {
+		return nil, ErrInvalidTags
+	}
+	return names, nil
 }
 
-func (uc *ItemUseCase) DeleteItem(id uint) error {
+// DeleteItem removes an item owned by the caller; admins may also remove
+// items owned by others.
+func (uc *ItemUseCase) DeleteItem(ownerID uint, role entities.Role, id uint) error {
+	if _, err := authorizeItem(uc.repo, ownerID, role, id); err != nil {
+		return err
+	}
 	return uc.repo.Delete(id)
 }
 
@@ -75,3 +472,45 @@ func (u *ItemUseCase) GetImageStream(ctx context.Context, fileName string) (*ent
 
 	return u.fileRepo.GetObject(ctx, fileName)
 }
+
+// itemCursor is the JSON form of a cursor. It records the ordering it was
+// issued for so that it is not replayed against a different one.
+type itemCursor struct {
+	Sort    entities.ItemSortField `json:"s"`
+	Desc    bool                   `json:"d,omitempty"`
+	ID      uint                   `json:"id"`
+	Name    string                 `json:"n,omitempty"`
+	Created *time.Time             `json:"c,omitempty"`
+}
+
+func encodeItemCursor(sort entities.ItemSortField, desc bool, last *entities.Item) string {
+	c := itemCursor{Sort: sort, Desc: desc, ID: last.ProductID}
+	switch sort {
+	case entities.ItemSortName:
+		c.Name = last.ProductName
+	case entities.ItemSortCreated:
+		c.Created = &last.CreatedAt
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeItemCursor(s string, sort entities.ItemSortField, desc bool) (*entities.ItemCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c itemCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Sort != sort || c.Desc != desc {
+		return nil, ErrInvalidCursor
+	}
+	if sort == entities.ItemSortCreated && c.Created == nil {
+		return nil, ErrInvalidCursor
+	}
+
+	after := &entities.ItemCursor{ID: c.ID, Name: c.Name}
+	if c.Created != nil {
+		after.CreatedAt = *c.Created
+	}
+	return after, nil
+}
@@ -0,0 +1,149 @@
+package use_cases
+
+import (
+	"errors"
+	"fmt"
+	"hole/entities"
+	"time"
+)
+
+var ErrTooManyAttempts = errors.New("too many failed login attempts")
+
+// LockoutError is returned while an account or client IP is locked out.
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("%s, retry in %s", ErrTooManyAttempts, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LockoutError) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
+
+type LoginAttemptStore interface {
+	// Find returns an empty attempt for unknown keys.
+	Find(key string) (*entities.LoginAttempt, error)
+	// RecordFailure atomically increments the failure counter.
+	RecordFailure(key string, at time.Time) (*entities.LoginAttempt, error)
+	Lock(key string, until time.Time) error
+	Reset(key string) error
+	ListLocked(now time.Time) ([]*entities.LoginAttempt, error)
+}
+
+type LockoutPolicy struct {
+	// Failures allowed before an account or IP is locked.
+	MaxAccountFailures int
+	MaxIPFailures      int
+	// The first lockout lasts BaseLockout and doubles with every further
+	// failure up to MaxLockout.
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	// Failures older than Window are forgotten.
+	Window time.Duration
+}
+
+func DefaultLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		MaxAccountFailures: 5,
+		MaxIPFailures:      20,
+		BaseLockout:        30 * time.Second,
+		MaxLockout:         15 * time.Minute,
+		Window:             15 * time.Minute,
+	}
+}
+
+// LoginThrottle tracks failed logins per account and per client IP.
+type LoginThrottle struct {
+	store  LoginAttemptStore
+	policy LockoutPolicy
+}
+
+func NewLoginThrottle(store LoginAttemptStore, policy LockoutPolicy) *LoginThrottle {
+	return &LoginThrottle{store: store, policy: policy}
+}
+
+// Check returns a LockoutError if either the account or the IP is locked.
+func (t *LoginThrottle) Check(email, ip string, now time.Time) error {
+	var retryAfter time.Duration
+	for _, key := range []string{accountKey(email), ipKey(ip)} {
+		a, err := t.store.Find(key)
+		if err != nil {
+			return err
+		}
+		if a.Locked(now) && a.LockedUntil.Sub(now) > retryAfter {
+			retryAfter = a.LockedUntil.Sub(now)
+		}
+	}
+
+	if retryAfter > 0 {
+		return &LockoutError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// Fail records a failed attempt and reports whether it caused a lockout.
+func (t *LoginThrottle) Fail(email, ip string, now time.Time) (bool, error) {
+	accountLocked, err := t.fail(accountKey(email), t.policy.MaxAccountFailures, now)
+	if err != nil {
+		return false, err
+	}
+	ipLocked, err := t.fail(ipKey(ip), t.policy.MaxIPFailures, now)
+	if err != nil {
+		return false, err
+	}
+	return accountLocked || ipLocked, nil
+}
+
+// Succeed clears the account counter. The IP counter is kept so that one
+// valid account cannot be used to reset throttling for a spraying client.
+func (t *LoginThrottle) Succeed(email string) error {
+	return t.store.Reset(accountKey(email))
+}
+
+func (t *LoginThrottle) Lockouts(now time.Time) ([]*entities.LoginAttempt, error) {
+	return t.store.ListLocked(now)
+}
+
+func (t *LoginThrottle) Unlock(key string) error {
+	return t.store.Reset(key)
+}
+
+func (t *LoginThrottle) fail(key string, max int, now time.Time) (bool, error) {
+	prev, err := t.store.Find(key)
+	if err != nil {
+		return false, err
+	}
+	if prev.Failures > 0 && now.Sub(prev.LastFailure) > t.policy.Window && !prev.Locked(now) {
+		if err := t.store.Reset(key); err != nil {
+			return false, err
+		}
+	}
+
+	a, err := t.store.RecordFailure(key, now)
+	if err != nil {
+		return false, err
+	}
+	if a.Failures < max {
+		return false, nil
+	}
+
+	lockout := t.policy.BaseLockout
+	for i := max; i < a.Failures && lockout < t.policy.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > t.policy.MaxLockout {
+		lockout = t.policy.MaxLockout
+	}
+
+	return true, t.store.Lock(key, now.Add(lockout))
+}
+
+func accountKey(email string) string {
+	return "account:" + NormalizeEmail(email)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,238 @@
+package use_cases_test
+
+import (
+	"errors"
+	"fmt"
+	"hole/entities"
+	"hole/repository"
+	"hole/use_cases"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testLockoutPolicy = use_cases.LockoutPolicy{
+	MaxAccountFailures: 3,
+	MaxIPFailures:      5,
+	BaseLockout:        time.Minute,
+	MaxLockout:         5 * time.Minute,
+	Window:             10 * time.Minute,
+}
+
+var epoch = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestThrottle() *use_cases.LoginThrottle {
+	return use_cases.NewLoginThrottle(repository.NewLoginAttemptRepositoryMemory(), testLockoutPolicy)
+}
+
+// fail records n failures a second apart, starting at now, and returns
+// whether the last one locked.
+func fail(t *testing.T, throttle *use_cases.LoginThrottle, email, ip string, now time.Time, n int) bool {
+	t.Helper()
+	var locked bool
+	for i := 0; i < n; i++ {
+		var err error
+		if locked, err = throttle.Fail(email, ip, now.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return locked
+}
+
+func retryAfter(t *testing.T, err error) time.Duration {
+	t.Helper()
+	var lockout *use_cases.LockoutError
+	if !errors.As(err, &lockout) {
+		t.Fatalf("err = %v, want a LockoutError", err)
+	}
+	return lockout.RetryAfter
+}
+
+func TestLoginThrottleAccountLockout(t *testing.T) {
+	throttle := newTestThrottle()
+
+	if fail(t, throttle, "ada@example.com", "10.0.0.1", epoch, 2) {
+		t.Fatal("locked before MaxAccountFailures")
+	}
+	if err := throttle.Check("ada@example.com", "10.0.0.1", epoch.Add(2*time.Second)); err != nil {
+		t.Fatalf("Check before lockout: %v", err)
+	}
+
+	at := epoch.Add(2 * time.Second)
+	if !fail(t, throttle, "ada@example.com", "10.0.0.1", at, 1) {
+		t.Fatal("not locked after MaxAccountFailures")
+	}
+
+	err := throttle.Check("ada@example.com", "10.0.0.2", at)
+	if !errors.Is(err, use_cases.ErrTooManyAttempts) {
+		t.Fatalf("err = %v, want ErrTooManyAttempts", err)
+	}
+	if d := retryAfter(t, err); d != time.Minute {
+		t.Errorf("RetryAfter = %s, want 1m", d)
+	}
+	// The account key is normalised
+	if err := throttle.Check(" ADA@example.com", "10.0.0.2", at); err == nil {
+		t.Error("differently cased email is not locked")
+	}
+	if err := throttle.Check("bob@example.com", "10.0.0.1", at); err != nil {
+		t.Errorf("other account from the same IP: %v", err)
+	}
+	if err := throttle.Check("ada@example.com", "10.0.0.1", at.Add(time.Minute)); err != nil {
+		t.Errorf("still locked after the lockout expired: %v", err)
+	}
+}
+
+func TestLoginThrottleIPLockout(t *testing.T) {
+	throttle := newTestThrottle()
+
+	// Spraying one password over many accounts never locks an account
+	emails := []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com", "e@example.com"}
+	var locked bool
+	for i, email := range emails {
+		locked = fail(t, throttle, email, "10.0.0.1", epoch.Add(time.Duration(i)*time.Second), 1)
+	}
+	if !locked {
+		t.Fatal("not locked after MaxIPFailures")
+	}
+
+	at := epoch.Add(5 * time.Second)
+	if err := throttle.Check("f@example.com", "10.0.0.1", at); !errors.Is(err, use_cases.ErrTooManyAttempts) {
+		t.Errorf("new account from the locked IP: err = %v, want ErrTooManyAttempts", err)
+	}
+	if err := throttle.Check("a@example.com", "10.0.0.2", at); err != nil {
+		t.Errorf("account from another IP: %v", err)
+	}
+}
+
+func TestLoginThrottleBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{6, 5 * time.Minute},
+		{10, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		throttle := newTestThrottle()
+		// Separate IPs keep the IP counter below its limit
+		var last time.Time
+		for i := 0; i < tt.failures; i++ {
+			last = epoch.Add(time.Duration(i) * time.Second)
+			if _, err := throttle.Fail("ada@example.com", fmt.Sprintf("10.0.0.%d", i), last); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err := throttle.Check("ada@example.com", "10.0.1.1", last)
+		if d := retryAfter(t, err); d != tt.want {
+			t.Errorf("after %d failures RetryAfter = %s, want %s", tt.failures, d, tt.want)
+		}
+	}
+}
+
+func TestLoginThrottleWindowReset(t *testing.T) {
+	throttle := newTestThrottle()
+	fail(t, throttle, "ada@example.com", "10.0.0.1", epoch, 2)
+
+	// Failures older than the window are forgotten, so this is the first
+	// failure of a new run
+	later := epoch.Add(testLockoutPolicy.Window + time.Minute)
+	if fail(t, throttle, "ada@example.com", "10.0.0.1", later, 2) {
+		t.Fatal("failures outside the window counted towards the lockout")
+	}
+	if !fail(t, throttle, "ada@example.com", "10.0.0.1", later.Add(time.Minute), 1) {
+		t.Fatal("not locked after MaxAccountFailures within the window")
+	}
+}
+
+func TestLoginThrottleLockedFailuresKeepCounting(t *testing.T) {
+	// A failure past the window while still locked extends the lockout
+	// instead of starting over
+	policy := testLockoutPolicy
+	policy.BaseLockout = time.Hour
+	policy.MaxLockout = 4 * time.Hour
+	throttle := use_cases.NewLoginThrottle(repository.NewLoginAttemptRepositoryMemory(), policy)
+	fail(t, throttle, "ada@example.com", "10.0.0.1", epoch, 3)
+
+	at := epoch.Add(policy.Window + time.Minute)
+	fail(t, throttle, "ada@example.com", "10.0.0.1", at, 1)
+	if d := retryAfter(t, throttle.Check("ada@example.com", "10.0.0.1", at)); d != 2*time.Hour {
+		t.Errorf("RetryAfter = %s, want 2h", d)
+	}
+}
+
+func TestLoginThrottleSucceedKeepsIPCounter(t *testing.T) {
+	throttle := newTestThrottle()
+	fail(t, throttle, "ada@example.com", "10.0.0.1", epoch, 2)
+	fail(t, throttle, "bob@example.com", "10.0.0.1", epoch, 2)
+
+	if err := throttle.Succeed("ada@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	// The account counter starts over, the IP counter does not
+	at := epoch.Add(time.Minute)
+	if !fail(t, throttle, "ada@example.com", "10.0.0.1", at, 1) {
+		t.Fatal("IP not locked after MaxIPFailures across accounts")
+	}
+	if err := throttle.Check("ada@example.com", "10.0.0.2", at); err != nil {
+		t.Errorf("account locked although its counter was reset: %v", err)
+	}
+	if err := throttle.Check("carol@example.com", "10.0.0.1", at); !errors.Is(err, use_cases.ErrTooManyAttempts) {
+		t.Errorf("err = %v, want ErrTooManyAttempts for the IP", err)
+	}
+}
+
+func TestLoginThrottleLockoutsAndUnlock(t *testing.T) {
+	throttle := newTestThrottle()
+	fail(t, throttle, "ada@example.com", "10.0.0.1", epoch, 3)
+
+	lockouts, err := throttle.Lockouts(epoch.Add(3 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lockouts) != 1 || lockouts[0].Key != "account:ada@example.com" {
+		t.Fatalf("Lockouts = %+v, want the account of ada", lockouts)
+	}
+
+	if err := throttle.Unlock(lockouts[0].Key); err != nil {
+		t.Fatal(err)
+	}
+	if err := throttle.Check("ada@example.com", "10.0.0.1", epoch.Add(3*time.Second)); err != nil {
+		t.Errorf("still locked after Unlock: %v", err)
+	}
+}
+
+func TestAuthUseCaseLoginLockout(t *testing.T) {
+	passwords, err := use_cases.NewPasswordPolicy(use_cases.PasswordRules{MinLength: 1, BcryptCost: bcrypt.MinCost}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := passwords.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := newFakeUsers(&entities.User{ID: 1, Email: "ada@example.com", Password: hash})
+	events := &fakeEvents{}
+	tokens := newFakeRefreshTokens()
+	uc := use_cases.NewAuthUseCase(users, tokens, &fakeTokens{}, events, newTestThrottle(), passwords, nil)
+	client := entities.ClientInfo{IP: "10.0.0.1"}
+
+	for i := 0; i < testLockoutPolicy.MaxAccountFailures; i++ {
+		if _, err := uc.Login("ada@example.com", "wrong", client); !errors.Is(err, use_cases.ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: err = %v, want ErrInvalidCredentials", i+1, err)
+		}
+	}
+	if n := events.count(entities.SecurityEventLoginLockout); n != 1 {
+		t.Errorf("lockout events = %d, want 1", n)
+	}
+
+	// Even the right password is refused while locked
+	if _, err := uc.Login("ada@example.com", "correct horse", client); !errors.Is(err, use_cases.ErrTooManyAttempts) {
+		t.Fatalf("err = %v, want ErrTooManyAttempts", err)
+	}
+}
@@ -0,0 +1,112 @@
+package use_cases
+
+import (
+	"errors"
+	"fmt"
+	"hole/entities"
+	"net/url"
+	"time"
+)
+
+type MagicLinkSettings struct {
+	// LinkURL is the page that receives the token as a query parameter.
+	LinkURL  string
+	TokenTTL time.Duration
+	// RequestInterval limits how often a link is sent to one account.
+	RequestInterval time.Duration
+	// BindBrowser requires the link to be opened in the browser that asked
+	// for it.
+	BindBrowser bool
+}
+
+// MagicLinkUseCase signs users in through single-use links sent by email.
+type MagicLinkUseCase struct {
+	users    UserRepository
+	tokens   OneTimeTokenRepository
+	mailer   Mailer
+	auth     *AuthUseCase
+	settings MagicLinkSettings
+}
+
+func NewMagicLinkUseCase(users UserRepository, tokens OneTimeTokenRepository, mailer Mailer, auth *AuthUseCase, settings MagicLinkSettings) *MagicLinkUseCase {
+	return &MagicLinkUseCase{users: users, tokens: tokens, mailer: mailer, auth: auth, settings: settings}
+}
+
+// RequestLink emails a sign-in link if the address belongs to an account.
+// Unknown addresses are not an error so callers cannot tell them apart. The
+// binding is the secret the requesting browser keeps for Login.
+func (uc *MagicLinkUseCase) RequestLink(email, binding string) error {
+	user, err := uc.users.FindByEmail(NormalizeEmail(email))
+	if errors.Is(err, entities.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	latest, err := uc.tokens.Latest(user.ID, entities.TokenPurposeMagicLogin)
+	if err != nil && !errors.Is(err, entities.ErrInvalidToken) {
+		return err
+	}
+	if latest != nil && time.Since(latest.CreatedAt) < uc.settings.RequestInterval {
+		return nil
+	}
+
+	now := time.Now()
+	if err := uc.tokens.InvalidateAll(user.ID, entities.TokenPurposeMagicLogin, now); err != nil {
+		return err
+	}
+
+	if !uc.settings.BindBrowser {
+		binding = ""
+	}
+	token := randomToken(32)
+	if err := uc.tokens.Create(&entities.OneTimeToken{
+		UserID:    user.ID,
+		Purpose:   entities.TokenPurposeMagicLogin,
+		Token:     token,
+		Binding:   binding,
+		Email:     user.Email,
+		ExpiresAt: now.Add(uc.settings.TokenTTL),
+	}); err != nil {
+		return err
+	}
+
+	link := uc.settings.LinkURL + "?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Sign in to your account with this link:\n\n%s\n\n"+
+		"The link works once and expires in %s. If you did not ask to sign in, you can ignore this email.",
+		link, uc.settings.TokenTTL)
+
+	return uc.mailer.Send(user.Email, "Your sign-in link", body)
+}
+
+// Login exchanges a link token for a session. Opening the link proves control
+// of the address, so an unverified account becomes verified.
+func (uc *MagicLinkUseCase) Login(token, binding string, client entities.ClientInfo) (*LoginResult, error) {
+	t, err := uc.tokens.ConsumeBound(entities.TokenPurposeMagicLogin, token, binding, time.Now())
+	if errors.Is(err, entities.ErrInvalidToken) && binding != "" {
+		// The token may have been issued without a binding
+		t, err = uc.tokens.Consume(entities.TokenPurposeMagicLogin, token, time.Now())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := uc.users.FindByID(t.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Email != t.Email {
+		return nil, entities.ErrInvalidToken
+	}
+
+	if !user.Verified() {
+		now := time.Now()
+		if err := uc.users.MarkVerified(user.ID, now); err != nil {
+			return nil, err
+		}
+		user.VerifiedAt = &now
+	}
+
+	return uc.auth.completeLogin(user, client)
+}
@@ -0,0 +1,234 @@
+package use_cases
+
+import (
+	"crypto/rand"
+	"errors"
+	"hole/entities"
+	"strings"
+	"time"
+)
+
+const (
+	MFAChallengeTTL   = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrMFANotEnrolled      = errors.New("two-factor authentication is not enrolled")
+	ErrMFAAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrInvalidMFACode      = errors.New("invalid two-factor code")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired MFA challenge")
+)
+
+type MFATokenService interface {
+	GenerateMFAChallenge(userID uint) (string, error)
+	ValidateMFAChallenge(token string) (uint, error)
+}
+
+type MFAUserRepository interface {
+	FindByID(id uint) (*entities.User, error)
+	SetTOTPSecret(id uint, secret string) error
+	EnableTOTP(id uint, at time.Time) error
+	DisableTOTP(id uint) error
+	AdvanceTOTPStep(id uint, step int64) (bool, error)
+}
+
+type RecoveryCodeRepository interface {
+	Replace(userID uint, codes []string) error
+	Consume(userID uint, code string, now time.Time) (bool, error)
+	DeleteAll(userID uint) error
+}
+
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// MFAUseCase manages TOTP enrollment and the second step of a login.
+type MFAUseCase struct {
+	users     MFAUserRepository
+	recovery  RecoveryCodeRepository
+	challenge MFATokenService
+	auth      *AuthUseCase
+	throttle  *LoginThrottle
+	clock     Clock
+	issuer    string
+}
+
+func NewMFAUseCase(users MFAUserRepository, recovery RecoveryCodeRepository, challenge MFATokenService, auth *AuthUseCase, throttle *LoginThrottle, clock Clock, issuer string) *MFAUseCase {
+	return &MFAUseCase{users: users, recovery: recovery, challenge: challenge, auth: auth, throttle: throttle, clock: clock, issuer: issuer}
+}
+
+// Enroll generates a new secret. TOTP is not enforced until Confirm succeeds,
+// so enrolling again simply replaces an unconfirmed secret.
+func (uc *MFAUseCase) Enroll(userID uint) (*TOTPEnrollment, error) {
+	user, err := uc.users.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabled() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	secret := totpEncoding.EncodeToString(raw)
+
+	if err := uc.users.SetTOTPSecret(userID, secret); err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		Secret: secret,
+		URI:    totpURI(uc.issuer, user.Email, secret),
+	}, nil
+}
+
+// Confirm enables TOTP with a first valid code and returns the recovery
+// codes, which are only ever shown this once.
+func (uc *MFAUseCase) Confirm(userID uint, code string) ([]string, error) {
+	user, err := uc.users.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabled() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+
+	if err := uc.checkTOTP(user, code); err != nil {
+		return nil, err
+	}
+
+	codes, err := uc.regenerateRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.users.EnableTOTP(userID, uc.clock.Now()); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Disable turns TOTP off after checking a current code or recovery code.
+func (uc *MFAUseCase) Disable(userID uint, code string) error {
+	user, err := uc.users.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if !user.MFAEnabled() {
+		return ErrMFANotEnrolled
+	}
+
+	if err := uc.checkSecondFactor(user, code); err != nil {
+		return err
+	}
+
+	if err := uc.recovery.DeleteAll(userID); err != nil {
+		return err
+	}
+	return uc.users.DisableTOTP(userID)
+}
+
+// CompleteLogin exchanges an MFA challenge and a TOTP or recovery code for an
+// access/refresh token pair.
+func (uc *MFAUseCase) CompleteLogin(challenge, code string, client entities.ClientInfo) (string, string, error) {
+	userID, err := uc.challenge.ValidateMFAChallenge(challenge)
+	if err != nil {
+		return "", "", ErrInvalidMFAChallenge
+	}
+
+	user, err := uc.users.FindByID(userID)
+	if err != nil {
+		return "", "", err
+	}
+	if !user.MFAEnabled() {
+		return "", "", ErrInvalidMFAChallenge
+	}
+
+	now := uc.clock.Now()
+	if err := uc.throttle.Check(user.Email, client.IP, now); err != nil {
+		return "", "", err
+	}
+
+	if err := uc.checkSecondFactor(user, code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			if _, ferr := uc.throttle.Fail(user.Email, client.IP, now); ferr != nil {
+				return "", "", ferr
+			}
+		}
+		return "", "", err
+	}
+
+	if err := uc.throttle.Succeed(user.Email); err != nil {
+		return "", "", err
+	}
+	return uc.auth.StartSession(userID, client)
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code.
+func (uc *MFAUseCase) checkSecondFactor(user *entities.User, code string) error {
+	err := uc.checkTOTP(user, code)
+	if !errors.Is(err, ErrInvalidMFACode) {
+		return err
+	}
+
+	ok, cerr := uc.recovery.Consume(user.ID, normalizeRecoveryCode(code), uc.clock.Now())
+	if cerr != nil {
+		return cerr
+	}
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (uc *MFAUseCase) checkTOTP(user *entities.User, code string) error {
+	step, ok := matchTOTP(user.TOTPSecret, code, uc.clock.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	// Each code can be used once, even within its validity window
+	fresh, err := uc.users.AdvanceTOTPStep(user.ID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (uc *MFAUseCase) regenerateRecoveryCodes(userID uint) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		encoded := strings.ToLower(totpEncoding.EncodeToString(raw))
+		codes[i] = encoded[:8] + "-" + encoded[8:16]
+	}
+
+	normalized := make([]string, len(codes))
+	for i, code := range codes {
+		normalized[i] = normalizeRecoveryCode(code)
+	}
+	if err := uc.recovery.Replace(userID, normalized); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
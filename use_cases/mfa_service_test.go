@@ -0,0 +1,259 @@
+package use_cases_test
+
+import (
+	"errors"
+	"hole/entities"
+	"hole/use_cases"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mfaFixture struct {
+	uc       *use_cases.MFAUseCase
+	users    *fakeUsers
+	recovery *fakeRecoveryCodes
+	refresh  *fakeRefreshTokens
+	clock    *fakeClock
+	tokens   *fakeTokens
+}
+
+func newMFAFixture() *mfaFixture {
+	f := &mfaFixture{
+		users:    newFakeUsers(&entities.User{ID: 1, Email: "ada@example.com"}),
+		recovery: newFakeRecoveryCodes(),
+		refresh:  newFakeRefreshTokens(),
+		clock:    &fakeClock{now: epoch},
+		tokens:   &fakeTokens{},
+	}
+	auth := use_cases.NewAuthUseCase(f.users, f.refresh, f.tokens, &fakeEvents{}, nil, nil, nil)
+	f.uc = use_cases.NewMFAUseCase(f.users, f.recovery, f.tokens, auth, newTestThrottle(), f.clock, "Hole")
+	return f
+}
+
+// enable enrolls user 1 and confirms the secret, then moves the clock to
+// the next time step so that a fresh code can be used.
+func (f *mfaFixture) enable(t *testing.T) (secret string, recoveryCodes []string) {
+	t.Helper()
+	enrollment, err := f.uc.Enroll(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := f.uc.Confirm(1, use_cases.TOTPCode(enrollment.Secret, f.clock.Now()))
+	if err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	f.clock.Advance(30 * time.Second)
+	return enrollment.Secret, codes
+}
+
+func (f *mfaFixture) code(secret string) string {
+	return use_cases.TOTPCode(secret, f.clock.Now())
+}
+
+func TestMFAEnrollAndConfirm(t *testing.T) {
+	f := newMFAFixture()
+
+	enrollment, err := f.uc.Enroll(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/Hole:ada@example.com?") {
+		t.Errorf("URI = %s", enrollment.URI)
+	}
+	if user, _ := f.users.FindByID(1); user.MFAEnabled() {
+		t.Fatal("MFA enabled before confirmation")
+	}
+
+	if _, err := f.uc.Confirm(1, "000000"); !errors.Is(err, use_cases.ErrInvalidMFACode) {
+		t.Fatalf("wrong code: err = %v, want ErrInvalidMFACode", err)
+	}
+	codes, err := f.uc.Confirm(1, use_cases.TOTPCode(enrollment.Secret, f.clock.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 {
+		t.Errorf("%d recovery codes, want 10", len(codes))
+	}
+	if user, _ := f.users.FindByID(1); !user.MFAEnabled() || !user.TOTPEnabledAt.Equal(epoch) {
+		t.Errorf("TOTPEnabledAt = %v, want %v", user.TOTPEnabledAt, epoch)
+	}
+
+	if _, err := f.uc.Enroll(1); !errors.Is(err, use_cases.ErrMFAAlreadyEnabled) {
+		t.Errorf("Enroll when enabled: err = %v, want ErrMFAAlreadyEnabled", err)
+	}
+}
+
+func TestMFAConfirmWithoutEnrollment(t *testing.T) {
+	f := newMFAFixture()
+	if _, err := f.uc.Confirm(1, "123456"); !errors.Is(err, use_cases.ErrMFANotEnrolled) {
+		t.Fatalf("err = %v, want ErrMFANotEnrolled", err)
+	}
+}
+
+func TestMFACompleteLogin(t *testing.T) {
+	f := newMFAFixture()
+	secret, _ := f.enable(t)
+	challenge, _ := f.tokens.GenerateMFAChallenge(1)
+
+	access, refresh, err := f.uc.CompleteLogin(challenge, f.code(secret), entities.ClientInfo{IP: "10.0.0.1"})
+	if err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+	if access == "" || refresh == "" {
+		t.Fatal("no tokens issued")
+	}
+	if _, err := f.refresh.FindByToken(refresh); err != nil {
+		t.Errorf("refresh token not stored: %v", err)
+	}
+}
+
+func TestMFACompleteLoginRejectsReplayedStep(t *testing.T) {
+	f := newMFAFixture()
+	secret, _ := f.enable(t)
+	challenge, _ := f.tokens.GenerateMFAChallenge(1)
+	code := f.code(secret)
+
+	if _, _, err := f.uc.CompleteLogin(challenge, code, entities.ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	// Still within the validity window of the code
+	f.clock.Advance(10 * time.Second)
+	if _, _, err := f.uc.CompleteLogin(challenge, code, entities.ClientInfo{}); !errors.Is(err, use_cases.ErrInvalidMFACode) {
+		t.Fatalf("replayed code: err = %v, want ErrInvalidMFACode", err)
+	}
+
+	// A code of an earlier step than the last one used is refused too
+	previous := use_cases.TOTPCode(secret, f.clock.Now().Add(-30*time.Second))
+	if _, _, err := f.uc.CompleteLogin(challenge, previous, entities.ClientInfo{}); !errors.Is(err, use_cases.ErrInvalidMFACode) {
+		t.Fatalf("earlier step: err = %v, want ErrInvalidMFACode", err)
+	}
+
+	f.clock.Advance(30 * time.Second)
+	if _, _, err := f.uc.CompleteLogin(challenge, f.code(secret), entities.ClientInfo{}); err != nil {
+		t.Fatalf("code of the next step: %v", err)
+	}
+}
+
+func TestMFACompleteLoginClockSkew(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset time.Duration
+		wantOK bool
+	}{
+		{"one step behind", -30 * time.Second, true},
+		{"one step ahead", 30 * time.Second, true},
+		{"two steps behind", -60 * time.Second, false},
+		{"two steps ahead", 60 * time.Second, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newMFAFixture()
+			secret, _ := f.enable(t)
+			// Move well past the step used to confirm
+			f.clock.Advance(5 * time.Minute)
+			challenge, _ := f.tokens.GenerateMFAChallenge(1)
+
+			code := use_cases.TOTPCode(secret, f.clock.Now().Add(tt.offset))
+			_, _, err := f.uc.CompleteLogin(challenge, code, entities.ClientInfo{})
+			if (err == nil) != tt.wantOK {
+				t.Errorf("err = %v, want success %v", err, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestMFACompleteLoginInvalidChallenge(t *testing.T) {
+	f := newMFAFixture()
+	secret, _ := f.enable(t)
+
+	if _, _, err := f.uc.CompleteLogin("garbage", f.code(secret), entities.ClientInfo{}); !errors.Is(err, use_cases.ErrInvalidMFAChallenge) {
+		t.Errorf("garbage challenge: err = %v, want ErrInvalidMFAChallenge", err)
+	}
+
+	// A challenge for an account without MFA cannot be completed
+	if err := f.users.Create(&entities.User{Email: "bob@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	challenge, _ := f.tokens.GenerateMFAChallenge(2)
+	if _, _, err := f.uc.CompleteLogin(challenge, f.code(secret), entities.ClientInfo{}); !errors.Is(err, use_cases.ErrInvalidMFAChallenge) {
+		t.Errorf("account without MFA: err = %v, want ErrInvalidMFAChallenge", err)
+	}
+}
+
+func TestMFACompleteLoginThrottlesWrongCodes(t *testing.T) {
+	f := newMFAFixture()
+	secret, _ := f.enable(t)
+	challenge, _ := f.tokens.GenerateMFAChallenge(1)
+	client := entities.ClientInfo{IP: "10.0.0.1"}
+
+	for i := 0; i < testLockoutPolicy.MaxAccountFailures; i++ {
+		if _, _, err := f.uc.CompleteLogin(challenge, "000000", client); !errors.Is(err, use_cases.ErrInvalidMFACode) {
+			t.Fatalf("attempt %d: err = %v, want ErrInvalidMFACode", i+1, err)
+		}
+	}
+	if _, _, err := f.uc.CompleteLogin(challenge, f.code(secret), client); !errors.Is(err, use_cases.ErrTooManyAttempts) {
+		t.Fatalf("err = %v, want ErrTooManyAttempts", err)
+	}
+
+	f.clock.Advance(testLockoutPolicy.BaseLockout)
+	if _, _, err := f.uc.CompleteLogin(challenge, f.code(secret), client); err != nil {
+		t.Fatalf("after the lockout: %v", err)
+	}
+}
+
+func TestMFARecoveryCodes(t *testing.T) {
+	f := newMFAFixture()
+	_, codes := f.enable(t)
+	challenge, _ := f.tokens.GenerateMFAChallenge(1)
+
+	// Codes are accepted regardless of case, dashes and spaces
+	typed := strings.ToUpper(strings.Replace(codes[0], "-", " ", 1))
+	if _, _, err := f.uc.CompleteLogin(challenge, typed, entities.ClientInfo{}); err != nil {
+		t.Fatalf("recovery code: %v", err)
+	}
+	if _, _, err := f.uc.CompleteLogin(challenge, codes[0], entities.ClientInfo{}); !errors.Is(err, use_cases.ErrInvalidMFACode) {
+		t.Fatalf("reused recovery code: err = %v, want ErrInvalidMFACode", err)
+	}
+	if _, _, err := f.uc.CompleteLogin(challenge, codes[1], entities.ClientInfo{}); err != nil {
+		t.Fatalf("second recovery code: %v", err)
+	}
+}
+
+func TestMFADisable(t *testing.T) {
+	f := newMFAFixture()
+	secret, codes := f.enable(t)
+
+	if err := f.uc.Disable(1, "000000"); !errors.Is(err, use_cases.ErrInvalidMFACode) {
+		t.Fatalf("wrong code: err = %v, want ErrInvalidMFACode", err)
+	}
+	if err := f.uc.Disable(1, codes[0]); err != nil {
+		t.Fatalf("Disable with a recovery code: %v", err)
+	}
+
+	user, _ := f.users.FindByID(1)
+	if user.MFAEnabled() || user.TOTPSecret != "" {
+		t.Error("TOTP still enabled")
+	}
+	if ok, _ := f.recovery.Consume(1, strings.ReplaceAll(codes[1], "-", ""), f.clock.Now()); ok {
+		t.Error("recovery codes survived Disable")
+	}
+	if err := f.uc.Disable(1, f.code(secret)); !errors.Is(err, use_cases.ErrMFANotEnrolled) {
+		t.Errorf("Disable twice: err = %v, want ErrMFANotEnrolled", err)
+	}
+}
+
+func TestMFAReenrollReplacesRecoveryCodes(t *testing.T) {
+	f := newMFAFixture()
+	_, oldCodes := f.enable(t)
+	if err := f.uc.Disable(1, oldCodes[0]); err != nil {
+		t.Fatal(err)
+	}
+	f.enable(t)
+
+	challenge, _ := f.tokens.GenerateMFAChallenge(1)
+	if _, _, err := f.uc.CompleteLogin(challenge, oldCodes[1], entities.ClientInfo{}); !errors.Is(err, use_cases.ErrInvalidMFACode) {
+		t.Fatalf("code of the previous enrollment: err = %v, want ErrInvalidMFACode", err)
+	}
+}
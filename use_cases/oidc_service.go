@@ -0,0 +1,190 @@
+package use_cases
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hole/entities"
+	"strings"
+	"time"
+)
+
+// OIDCStateTTL bounds the time between leaving for the provider and
+// coming back to the callback.
+const OIDCStateTTL = 10 * time.Minute
+
+var (
+	ErrUnknownProvider      = errors.New("unknown identity provider")
+	ErrInvalidOIDCState     = errors.New("invalid or expired sign-in state")
+	ErrIdentityProvider     = errors.New("identity provider sign-in failed")
+	ErrOIDCEmailNotVerified = errors.New("identity provider did not verify the email address")
+	ErrOIDCLinkUnverified   = errors.New("an account with this email exists but its address is not verified; sign in with your password and verify it first")
+)
+
+// ExternalIdentity is what a provider asserts about the user in a validated
+// ID token.
+type ExternalIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Nonce         string
+}
+
+// IdentityProvider is an OpenID Connect provider using the authorization
+// code flow with PKCE.
+type IdentityProvider interface {
+	AuthCodeURL(state, nonce, codeChallenge string) (string, error)
+	// Exchange redeems the code and returns the claims of the ID token after
+	// checking its signature, issuer, audience and expiry.
+	Exchange(ctx context.Context, code, codeVerifier string) (*ExternalIdentity, error)
+}
+
+type OIDCStateRepository interface {
+	Create(state *entities.OIDCState) error
+	Consume(state string, now time.Time) (*entities.OIDCState, error)
+}
+
+type UserIdentityRepository interface {
+	Create(identity *entities.UserIdentity) error
+	FindBySubject(provider, subject string) (*entities.UserIdentity, error)
+}
+
+// OIDCUseCase signs users in through external identity providers, linking
+// provider accounts to users by verified email.
+type OIDCUseCase struct {
+	providers  map[string]IdentityProvider
+	states     OIDCStateRepository
+	identities UserIdentityRepository
+	users      UserRepository
+	auth       *AuthUseCase
+}
+
+func NewOIDCUseCase(providers map[string]IdentityProvider, states OIDCStateRepository, identities UserIdentityRepository, users UserRepository, auth *AuthUseCase) *OIDCUseCase {
+	return &OIDCUseCase{providers: providers, states: states, identities: identities, users: users, auth: auth}
+}
+
+// Begin starts a sign-in and returns the provider URL to redirect to and the
+// state the callback must present.
+func (uc *OIDCUseCase) Begin(provider string) (string, string, error) {
+	p, ok := uc.providers[provider]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+
+	pending := &entities.OIDCState{
+		State:        randomToken(32),
+		Provider:     provider,
+		Nonce:        randomToken(32),
+		CodeVerifier: randomToken(32),
+		ExpiresAt:    time.Now().Add(OIDCStateTTL),
+	}
+
+	challenge := sha256.Sum256([]byte(pending.CodeVerifier))
+	authURL, err := p.AuthCodeURL(pending.State, pending.Nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrIdentityProvider, err)
+	}
+
+	if err := uc.states.Create(pending); err != nil {
+		return "", "", err
+	}
+	return authURL, pending.State, nil
+}
+
+// Complete handles the provider callback and signs the user in exactly as a
+// password login would, including the two-factor step.
+func (uc *OIDCUseCase) Complete(ctx context.Context, provider, state, code string, client entities.ClientInfo) (*LoginResult, error) {
+	p, ok := uc.providers[provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	pending, err := uc.states.Consume(state, time.Now())
+	if errors.Is(err, entities.ErrInvalidToken) || (err == nil && pending.Provider != provider) {
+		return nil, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ext, err := p.Exchange(ctx, code, pending.CodeVerifier)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIdentityProvider, err)
+	}
+	// The nonce ties the ID token to this sign-in and defeats replayed tokens
+	if subtle.ConstantTimeCompare([]byte(ext.Nonce), []byte(pending.Nonce)) != 1 {
+		return nil, ErrInvalidOIDCState
+	}
+
+	user, err := uc.resolveUser(provider, ext)
+	if err != nil {
+		return nil, err
+	}
+	return uc.auth.completeLogin(user, client)
+}
+
+// resolveUser finds the user linked to the provider account, linking or
+// creating one by email on first sign-in.
+func (uc *OIDCUseCase) resolveUser(provider string, ext *ExternalIdentity) (*entities.User, error) {
+	identity, err := uc.identities.FindBySubject(provider, ext.Subject)
+	if err == nil {
+		return uc.users.FindByID(identity.UserID)
+	}
+	if !errors.Is(err, entities.ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	if !ext.EmailVerified {
+		return nil, ErrOIDCEmailNotVerified
+	}
+	email := NormalizeEmail(ext.Email)
+	if err := ValidateEmail(email); err != nil {
+		return nil, err
+	}
+
+	user, err := uc.users.FindByEmail(email)
+	switch {
+	case err == nil:
+		// Linking to an unverified account would hand it to whoever
+		// registered the address, who may not own it.
+		if !user.Verified() {
+			return nil, ErrOIDCLinkUnverified
+		}
+	case errors.Is(err, entities.ErrUserNotFound):
+		now := time.Now()
+		user = &entities.User{
+			Email:       email,
+			DisplayName: displayNameFrom(ext.Name),
+			VerifiedAt:  &now,
+			Role:        entities.RoleViewer,
+		}
+		if err := uc.users.Create(user); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	if err := uc.identities.Create(&entities.UserIdentity{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  ext.Subject,
+		Email:    email,
+	}); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// displayNameFrom trims a provider supplied name to the profile limit.
+func displayNameFrom(name string) string {
+	runes := []rune(strings.TrimSpace(name))
+	if len(runes) > 100 {
+		runes = runes[:100]
+	}
+	return string(runes)
+}
@@ -0,0 +1,271 @@
+package use_cases_test
+
+import (
+	"context"
+	"errors"
+	"hole/entities"
+	"hole/use_cases"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type oidcFixture struct {
+	uc         *use_cases.OIDCUseCase
+	idp        *fakeIdentityProvider
+	states     *fakeOIDCStates
+	identities *fakeIdentities
+	users      *fakeUsers
+	refresh    *fakeRefreshTokens
+}
+
+func newOIDCFixture(users ...*entities.User) *oidcFixture {
+	f := &oidcFixture{
+		idp: &fakeIdentityProvider{identity: use_cases.ExternalIdentity{
+			Subject:       "subject-1",
+			Email:         "Ada@Example.com",
+			EmailVerified: true,
+			Name:          "  Ada Lovelace ",
+		}},
+		states:     newFakeOIDCStates(),
+		identities: &fakeIdentities{},
+		users:      newFakeUsers(users...),
+		refresh:    newFakeRefreshTokens(),
+	}
+	auth := use_cases.NewAuthUseCase(f.users, f.refresh, &fakeTokens{}, &fakeEvents{}, nil, nil, nil)
+	f.uc = use_cases.NewOIDCUseCase(map[string]use_cases.IdentityProvider{"mock": f.idp}, f.states, f.identities, f.users, auth)
+	return f
+}
+
+// signIn begins a sign-in with the mock provider and completes its callback.
+func (f *oidcFixture) signIn(t *testing.T) (*use_cases.LoginResult, error) {
+	t.Helper()
+	_, state, err := f.uc.Begin("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f.uc.Complete(context.Background(), "mock", state, "code-1", entities.ClientInfo{})
+}
+
+func TestOIDCBegin(t *testing.T) {
+	f := newOIDCFixture()
+
+	if _, _, err := f.uc.Begin("unknown"); !errors.Is(err, use_cases.ErrUnknownProvider) {
+		t.Fatalf("unknown provider: err = %v, want ErrUnknownProvider", err)
+	}
+
+	authURL, state, err := f.uc.Begin("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authURL)
+	if u.Query().Get("state") != state {
+		t.Errorf("authorization URL carries state %q, want %q", u.Query().Get("state"), state)
+	}
+	if f.idp.nonce == "" || f.idp.challenge == "" {
+		t.Error("no nonce or PKCE challenge sent to the provider")
+	}
+
+	_, other, _ := f.uc.Begin("mock")
+	if other == state {
+		t.Error("two sign-ins share a state")
+	}
+}
+
+func TestOIDCCompleteState(t *testing.T) {
+	f := newOIDCFixture()
+	_, state, err := f.uc.Begin("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.uc.Complete(context.Background(), "mock", "forged", "code-1", entities.ClientInfo{}); !errors.Is(err, use_cases.ErrInvalidOIDCState) {
+		t.Fatalf("unknown state: err = %v, want ErrInvalidOIDCState", err)
+	}
+	if _, err := f.uc.Complete(context.Background(), "mock", state, "code-1", entities.ClientInfo{}); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if _, err := f.uc.Complete(context.Background(), "mock", state, "code-1", entities.ClientInfo{}); !errors.Is(err, use_cases.ErrInvalidOIDCState) {
+		t.Fatalf("reused state: err = %v, want ErrInvalidOIDCState", err)
+	}
+}
+
+func TestOIDCCompleteExpiredState(t *testing.T) {
+	f := newOIDCFixture()
+	_, state, err := f.uc.Begin("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.states.expire()
+
+	if _, err := f.uc.Complete(context.Background(), "mock", state, "code-1", entities.ClientInfo{}); !errors.Is(err, use_cases.ErrInvalidOIDCState) {
+		t.Fatalf("err = %v, want ErrInvalidOIDCState", err)
+	}
+}
+
+func TestOIDCCompleteStateOfAnotherProvider(t *testing.T) {
+	f := newOIDCFixture()
+	other := &fakeIdentityProvider{identity: f.idp.identity}
+	auth := use_cases.NewAuthUseCase(f.users, f.refresh, &fakeTokens{}, &fakeEvents{}, nil, nil, nil)
+	uc := use_cases.NewOIDCUseCase(map[string]use_cases.IdentityProvider{"mock": f.idp, "other": other}, f.states, f.identities, f.users, auth)
+
+	_, state, err := uc.Begin("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uc.Complete(context.Background(), "mock", state, "code-1", entities.ClientInfo{}); !errors.Is(err, use_cases.ErrInvalidOIDCState) {
+		t.Fatalf("err = %v, want ErrInvalidOIDCState", err)
+	}
+}
+
+func TestOIDCCompleteRejectsNonceMismatch(t *testing.T) {
+	f := newOIDCFixture()
+	f.idp.identity.Nonce = "nonce-of-another-sign-in"
+
+	if _, err := f.signIn(t); !errors.Is(err, use_cases.ErrInvalidOIDCState) {
+		t.Fatalf("err = %v, want ErrInvalidOIDCState", err)
+	}
+	if len(f.users.users) != 0 {
+		t.Error("user created from an ID token with the wrong nonce")
+	}
+}
+
+func TestOIDCCompleteSendsPKCEVerifier(t *testing.T) {
+	f := newOIDCFixture()
+	_, state, err := f.uc.Begin("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A later sign-in replaces the challenge the provider expects
+	if _, _, err := f.uc.Begin("mock"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.uc.Complete(context.Background(), "mock", state, "code-1", entities.ClientInfo{}); !errors.Is(err, use_cases.ErrIdentityProvider) {
+		t.Fatalf("err = %v, want ErrIdentityProvider", err)
+	}
+}
+
+func TestOIDCCompleteProviderError(t *testing.T) {
+	f := newOIDCFixture()
+	f.idp.err = errors.New("token signature is invalid")
+
+	if _, err := f.signIn(t); !errors.Is(err, use_cases.ErrIdentityProvider) {
+		t.Fatalf("err = %v, want ErrIdentityProvider", err)
+	}
+}
+
+func TestOIDCAccountLinking(t *testing.T) {
+	verified := time.Now()
+
+	tests := []struct {
+		name       string
+		users      []*entities.User
+		linked     bool
+		unverified bool
+		wantErr    error
+		wantUser   uint
+	}{
+		{
+			name:     "new email creates a verified viewer",
+			wantUser: 1,
+		},
+		{
+			name:     "verified email links the existing verified user",
+			users:    []*entities.User{{ID: 1, Email: "ada@example.com", VerifiedAt: &verified, Role: entities.RoleEditor}},
+			wantUser: 1,
+		},
+		{
+			name:    "existing user with an unverified address is not linked",
+			users:   []*entities.User{{ID: 1, Email: "ada@example.com"}},
+			wantErr: use_cases.ErrOIDCLinkUnverified,
+		},
+		{
+			name:       "email not verified by the provider",
+			unverified: true,
+			wantErr:    use_cases.ErrOIDCEmailNotVerified,
+		},
+		{
+			name: "linked identity signs in its user regardless of email",
+			users: []*entities.User{
+				{ID: 1, Email: "ada@example.com", VerifiedAt: &verified},
+				{ID: 2, Email: "ada@elsewhere.example.com"},
+			},
+			linked:     true,
+			unverified: true,
+			wantUser:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOIDCFixture(tt.users...)
+			f.idp.identity.EmailVerified = !tt.unverified
+			if tt.linked {
+				f.identities.Create(&entities.UserIdentity{UserID: 2, Provider: "mock", Subject: "subject-1"})
+			}
+
+			result, err := f.signIn(t)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				if len(f.identities.identities) != 0 {
+					t.Error("identity linked despite the error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.AccessToken == "" || result.RefreshToken == "" {
+				t.Fatalf("result = %+v, want tokens", result)
+			}
+
+			stored, err := f.refresh.FindByToken(result.RefreshToken)
+			if err != nil || stored.UserID != tt.wantUser {
+				t.Fatalf("session for user %v (%v), want %d", stored, err, tt.wantUser)
+			}
+			identity, err := f.identities.FindBySubject("mock", "subject-1")
+			if err != nil || identity.UserID != tt.wantUser {
+				t.Errorf("identity = %+v (%v), want one linked to user %d", identity, err, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestOIDCCreatesUser(t *testing.T) {
+	f := newOIDCFixture()
+	if _, err := f.signIn(t); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := f.users.FindByEmail("ada@example.com")
+	if err != nil {
+		t.Fatalf("no user for the normalized email: %v", err)
+	}
+	if !user.Verified() || user.Role != entities.RoleViewer || user.DisplayName != "Ada Lovelace" {
+		t.Errorf("user = %+v, want a verified viewer named Ada Lovelace", user)
+	}
+
+	// The next sign-in finds the same user through the linked identity
+	if _, err := f.signIn(t); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.users.users) != 1 || len(f.identities.identities) != 1 {
+		t.Errorf("%d users and %d identities after signing in twice, want 1 and 1", len(f.users.users), len(f.identities.identities))
+	}
+}
+
+func TestOIDCCompleteRequiresMFA(t *testing.T) {
+	verified := time.Now()
+	f := newOIDCFixture(&entities.User{ID: 1, Email: "ada@example.com", VerifiedAt: &verified, TOTPEnabledAt: &verified})
+
+	result, err := f.signIn(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.MFAChallenge == "" || result.AccessToken != "" || result.RefreshToken != "" {
+		t.Fatalf("result = %+v, want only an MFA challenge", result)
+	}
+}
@@ -0,0 +1,182 @@
+package use_cases
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidEmail = errors.New("invalid email address")
+	ErrWeakPassword = errors.New("password does not meet the policy")
+)
+
+// WeakPasswordError lists every rule a rejected password failed.
+type WeakPasswordError struct {
+	Reasons []string
+}
+
+func (e *WeakPasswordError) Error() string {
+	return ErrWeakPassword.Error() + ": " + strings.Join(e.Reasons, "; ")
+}
+
+func (e *WeakPasswordError) Is(target error) bool {
+	return target == ErrWeakPassword
+}
+
+type PasswordRules struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	BcryptCost    int
+}
+
+func DefaultPasswordRules() PasswordRules {
+	return PasswordRules{
+		MinLength:    8,
+		RequireLower: true,
+		RequireDigit: true,
+		BcryptCost:   bcrypt.DefaultCost,
+	}
+}
+
+// PasswordPolicy validates and hashes passwords.
+type PasswordPolicy struct {
+	rules     PasswordRules
+	breached  map[string]struct{}
+	dummyHash []byte
+}
+
+// NewPasswordPolicy builds a policy from rules and a list of breached
+// passwords; entries may be plaintext or SHA-1 hex digests as published by
+// Have I Been Pwned.
+func NewPasswordPolicy(rules PasswordRules, breached []string) (*PasswordPolicy, error) {
+	if rules.BcryptCost < bcrypt.MinCost || rules.BcryptCost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	p := &PasswordPolicy{rules: rules, breached: make(map[string]struct{}, len(breached))}
+	for _, entry := range breached {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if isSHA1Hex(entry) {
+			p.breached[strings.ToLower(entry)] = struct{}{}
+		} else {
+			p.breached[sha1Hex(entry)] = struct{}{}
+		}
+	}
+
+	// Compared against when no user matches, at the same cost as real hashes.
+	dummy, err := bcrypt.GenerateFromPassword([]byte("not-a-real-password"), rules.BcryptCost)
+	if err != nil {
+		return nil, err
+	}
+	p.dummyHash = dummy
+
+	return p, nil
+}
+
+func (p *PasswordPolicy) Validate(password string) error {
+	var reasons []string
+
+	if len([]rune(password)) < p.rules.MinLength {
+		reasons = append(reasons, fmt.Sprintf("must be at least %d characters", p.rules.MinLength))
+	}
+	// bcrypt silently ignores everything past 72 bytes
+	if len(password) > 72 {
+		reasons = append(reasons, "must be at most 72 bytes")
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+	if p.rules.RequireUpper && !upper {
+		reasons = append(reasons, "must contain an uppercase letter")
+	}
+	if p.rules.RequireLower && !lower {
+		reasons = append(reasons, "must contain a lowercase letter")
+	}
+	if p.rules.RequireDigit && !digit {
+		reasons = append(reasons, "must contain a digit")
+	}
+	if p.rules.RequireSymbol && !symbol {
+		reasons = append(reasons, "must contain a symbol")
+	}
+
+	if _, ok := p.breached[sha1Hex(password)]; ok {
+		reasons = append(reasons, "appears in a list of breached passwords")
+	}
+
+	if len(reasons) > 0 {
+		return &WeakPasswordError{Reasons: reasons}
+	}
+	return nil
+}
+
+func (p *PasswordPolicy) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), p.rules.BcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Compare checks a password against a hash; a nil hash is compared against a
+// dummy so that unknown accounts take as long as known ones.
+func (p *PasswordPolicy) Compare(hash []byte, password string) bool {
+	if hash == nil {
+		bcrypt.CompareHashAndPassword(p.dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+}
+
+// NormalizeEmail trims and case-folds an address.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// ValidateEmail accepts bare addresses such as "user@example.com" only.
+func ValidateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" {
+		return ErrInvalidEmail
+	}
+	if _, domain, _ := strings.Cut(email, "@"); !strings.Contains(domain, ".") {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,108 @@
+package use_cases
+
+import (
+	"errors"
+	"fmt"
+	"hole/entities"
+	"net/url"
+	"time"
+)
+
+type SessionRevoker interface {
+	LogoutAll(userID uint) error
+}
+
+type PasswordResetSettings struct {
+	// LinkURL is the page that receives the token as a query parameter.
+	LinkURL  string
+	TokenTTL time.Duration
+	// RequestInterval limits how often a reset email is sent to one account.
+	RequestInterval time.Duration
+}
+
+type PasswordResetUseCase struct {
+	users     UserRepository
+	tokens    OneTimeTokenRepository
+	mailer    Mailer
+	passwords *PasswordPolicy
+	sessions  SessionRevoker
+	settings  PasswordResetSettings
+}
+
+func NewPasswordResetUseCase(users UserRepository, tokens OneTimeTokenRepository, mailer Mailer, passwords *PasswordPolicy, sessions SessionRevoker, settings PasswordResetSettings) *PasswordResetUseCase {
+	return &PasswordResetUseCase{users: users, tokens: tokens, mailer: mailer, passwords: passwords, sessions: sessions, settings: settings}
+}
+
+// RequestReset emails a reset link if the address belongs to an account.
+// Unknown addresses are not an error so callers cannot tell them apart.
+func (uc *PasswordResetUseCase) RequestReset(email string) error {
+	user, err := uc.users.FindByEmail(NormalizeEmail(email))
+	if errors.Is(err, entities.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	latest, err := uc.tokens.Latest(user.ID, entities.TokenPurposeResetPassword)
+	if err != nil && !errors.Is(err, entities.ErrInvalidToken) {
+		return err
+	}
+	if latest != nil && time.Since(latest.CreatedAt) < uc.settings.RequestInterval {
+		return nil
+	}
+
+	now := time.Now()
+	if err := uc.tokens.InvalidateAll(user.ID, entities.TokenPurposeResetPassword, now); err != nil {
+		return err
+	}
+
+	token := randomToken(32)
+	if err := uc.tokens.Create(&entities.OneTimeToken{
+		UserID:    user.ID,
+		Purpose:   entities.TokenPurposeResetPassword,
+		Token:     token,
+		Email:     user.Email,
+		ExpiresAt: now.Add(uc.settings.TokenTTL),
+	}); err != nil {
+		return err
+	}
+
+	link := uc.settings.LinkURL + "?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("A password reset was requested for your account. Choose a new password here:\n\n%s\n\n"+
+		"The link expires in %s. If you did not request this, you can ignore this email.",
+		link, uc.settings.TokenTTL)
+
+	return uc.mailer.Send(user.Email, "Reset your password", body)
+}
+
+// ResetPassword sets a new password and signs the user out everywhere.
+func (uc *PasswordResetUseCase) ResetPassword(token, password string) error {
+	// Validate first so a weak password does not burn the token
+	if err := uc.passwords.Validate(password); err != nil {
+		return err
+	}
+
+	t, err := uc.tokens.Consume(entities.TokenPurposeResetPassword, token, time.Now())
+	if err != nil {
+		return err
+	}
+
+	user, err := uc.users.FindByID(t.UserID)
+	if err != nil {
+		return err
+	}
+	if user.Email != t.Email {
+		return entities.ErrInvalidToken
+	}
+
+	hash, err := uc.passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+	if err := uc.users.UpdatePassword(user.ID, hash); err != nil {
+		return err
+	}
+
+	return uc.sessions.LogoutAll(user.ID)
+}
@@ -0,0 +1,213 @@
+package use_cases_test
+
+import (
+	"errors"
+	"hole/adapters"
+	"hole/entities"
+	"hole/use_cases"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const resetPageURL = "https://app.example.com/reset-password"
+
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+// mailedToken extracts the token from the link in the last message sent to
+// the given address.
+func mailedToken(t *testing.T, outbox *adapters.MemoryMailer, to string) string {
+	t.Helper()
+	messages := outbox.Messages()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].To != to {
+			continue
+		}
+		link, err := url.Parse(linkPattern.FindString(messages[i].Body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token := link.Query().Get("token"); token != "" {
+			return token
+		}
+	}
+	t.Fatalf("no link mailed to %s", to)
+	return ""
+}
+
+func testPasswordPolicy(t *testing.T) *use_cases.PasswordPolicy {
+	t.Helper()
+	rules := use_cases.DefaultPasswordRules()
+	rules.BcryptCost = bcrypt.MinCost
+	policy, err := use_cases.NewPasswordPolicy(rules, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+type resetFixture struct {
+	uc       *use_cases.PasswordResetUseCase
+	users    *fakeUsers
+	tokens   *fakeOneTimeTokens
+	outbox   *adapters.MemoryMailer
+	sessions *fakeSessions
+	policy   *use_cases.PasswordPolicy
+}
+
+func newResetFixture(t *testing.T, interval time.Duration) *resetFixture {
+	t.Helper()
+	f := &resetFixture{
+		users:    newFakeUsers(&entities.User{ID: 1, Email: "ada@example.com", Password: "old"}),
+		tokens:   newFakeOneTimeTokens(),
+		outbox:   adapters.NewMemoryMailer(),
+		sessions: &fakeSessions{},
+		policy:   testPasswordPolicy(t),
+	}
+	f.uc = use_cases.NewPasswordResetUseCase(f.users, f.tokens, f.outbox, f.policy, f.sessions, use_cases.PasswordResetSettings{
+		LinkURL:         resetPageURL,
+		TokenTTL:        time.Hour,
+		RequestInterval: interval,
+	})
+	return f
+}
+
+func TestPasswordResetRequestAndConfirm(t *testing.T) {
+	f := newResetFixture(t, 0)
+
+	if err := f.uc.RequestReset(" Ada@Example.com"); err != nil {
+		t.Fatal(err)
+	}
+	messages := f.outbox.Messages()
+	if len(messages) != 1 || messages[0].To != "ada@example.com" {
+		t.Fatalf("outbox = %+v, want one message to ada", messages)
+	}
+	link := linkPattern.FindString(messages[0].Body)
+	if u, _ := url.Parse(link); u == nil || u.Scheme+"://"+u.Host+u.Path != resetPageURL {
+		t.Errorf("link %q does not point at the reset page", link)
+	}
+
+	token := mailedToken(t, f.outbox, "ada@example.com")
+	if err := f.uc.ResetPassword(token, "new password 1"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+
+	user, _ := f.users.FindByID(1)
+	if !f.policy.Compare([]byte(user.Password), "new password 1") {
+		t.Error("password was not changed")
+	}
+	if len(f.sessions.loggedOut) != 1 || f.sessions.loggedOut[0] != 1 {
+		t.Errorf("sessions revoked for %v, want [1]", f.sessions.loggedOut)
+	}
+}
+
+func TestPasswordResetUnknownEmail(t *testing.T) {
+	f := newResetFixture(t, 0)
+
+	if err := f.uc.RequestReset("nobody@example.com"); err != nil {
+		t.Fatalf("unknown email: %v, want no error", err)
+	}
+	if n := len(f.outbox.Messages()); n != 0 {
+		t.Errorf("%d messages sent for an unknown email", n)
+	}
+}
+
+func TestPasswordResetTokenReuse(t *testing.T) {
+	f := newResetFixture(t, 0)
+	if err := f.uc.RequestReset("ada@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	token := mailedToken(t, f.outbox, "ada@example.com")
+
+	if err := f.uc.ResetPassword(token, "new password 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.uc.ResetPassword(token, "new password 2"); !errors.Is(err, entities.ErrInvalidToken) {
+		t.Fatalf("reused token: err = %v, want ErrInvalidToken", err)
+	}
+	user, _ := f.users.FindByID(1)
+	if !f.policy.Compare([]byte(user.Password), "new password 1") {
+		t.Error("reused token changed the password")
+	}
+}
+
+func TestPasswordResetTokenExpiry(t *testing.T) {
+	f := newResetFixture(t, 0)
+	if err := f.uc.RequestReset("ada@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	token := mailedToken(t, f.outbox, "ada@example.com")
+	f.tokens.expire()
+
+	if err := f.uc.ResetPassword(token, "new password 1"); !errors.Is(err, entities.ErrInvalidToken) {
+		t.Fatalf("expired token: err = %v, want ErrInvalidToken", err)
+	}
+	if len(f.sessions.loggedOut) != 0 {
+		t.Error("sessions revoked for an expired token")
+	}
+}
+
+func TestPasswordResetNewRequestInvalidatesOldToken(t *testing.T) {
+	f := newResetFixture(t, 0)
+	if err := f.uc.RequestReset("ada@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	first := mailedToken(t, f.outbox, "ada@example.com")
+	if err := f.uc.RequestReset("ada@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	second := mailedToken(t, f.outbox, "ada@example.com")
+
+	if err := f.uc.ResetPassword(first, "new password 1"); !errors.Is(err, entities.ErrInvalidToken) {
+		t.Fatalf("superseded token: err = %v, want ErrInvalidToken", err)
+	}
+	if err := f.uc.ResetPassword(second, "new password 1"); err != nil {
+		t.Fatalf("latest token: %v", err)
+	}
+}
+
+func TestPasswordResetRequestInterval(t *testing.T) {
+	f := newResetFixture(t, time.Hour)
+	for i := 0; i < 3; i++ {
+		if err := f.uc.RequestReset("ada@example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(f.outbox.Messages()); n != 1 {
+		t.Errorf("%d messages sent within the request interval, want 1", n)
+	}
+}
+
+func TestPasswordResetWeakPasswordKeepsToken(t *testing.T) {
+	f := newResetFixture(t, 0)
+	if err := f.uc.RequestReset("ada@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	token := mailedToken(t, f.outbox, "ada@example.com")
+
+	if err := f.uc.ResetPassword(token, "short"); !errors.Is(err, use_cases.ErrWeakPassword) {
+		t.Fatalf("err = %v, want ErrWeakPassword", err)
+	}
+	if err := f.uc.ResetPassword(token, "new password 1"); err != nil {
+		t.Fatalf("token burnt by a weak password: %v", err)
+	}
+}
+
+func TestPasswordResetAfterEmailChange(t *testing.T) {
+	f := newResetFixture(t, 0)
+	if err := f.uc.RequestReset("ada@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	token := mailedToken(t, f.outbox, "ada@example.com")
+	if err := f.users.UpdateEmail(1, "ada@new.example.com", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A link sent to the old address no longer controls the account
+	if err := f.uc.ResetPassword(token, "new password 1"); !errors.Is(err, entities.ErrInvalidToken) {
+		t.Fatalf("err = %v, want ErrInvalidToken", err)
+	}
+}
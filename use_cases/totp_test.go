@@ -0,0 +1,94 @@
+package use_cases
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed of the RFC 6238 test vectors, "12345678901234567890".
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238Vectors(t *testing.T) {
+	// RFC 6238 Appendix B lists 8-digit SHA-1 codes; 6-digit codes are their
+	// last six digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	secret, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if got := totpCode(secret, totpStep(time.Unix(tt.unix, 0))); got != tt.want {
+			t.Errorf("T=%d: code = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := totpStep(now)
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", rfc6238Secret, "050471", step, true},
+		{"spaces are ignored", rfc6238Secret, "050 471", step, true},
+		{"lower-case secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "050471", step, true},
+		{"previous step", rfc6238Secret, codeAt(t, now.Add(-totpPeriod*time.Second)), step - 1, true},
+		{"next step", rfc6238Secret, codeAt(t, now.Add(totpPeriod*time.Second)), step + 1, true},
+		{"beyond the skew", rfc6238Secret, codeAt(t, now.Add(-2*totpPeriod*time.Second)), 0, false},
+		{"wrong code", rfc6238Secret, "000000", 0, false},
+		{"malformed secret", "not base32!", "050471", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := matchTOTP(tt.secret, tt.code, now)
+			if ok != tt.wantOK || got != tt.wantStep {
+				t.Errorf("matchTOTP = %d, %v, want %d, %v", got, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func codeAt(t *testing.T, at time.Time) string {
+	t.Helper()
+	secret, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return totpCode(secret, totpStep(at))
+}
+
+func TestTOTPURI(t *testing.T) {
+	u, err := url.Parse(totpURI("Hole Shop", "ada@example.com", rfc6238Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Hole Shop:ada@example.com" {
+		t.Errorf("URI = %s, want otpauth://totp/Hole Shop:ada@example.com", u)
+	}
+	q := u.Query()
+	for key, want := range map[string]string{
+		"secret": rfc6238Secret, "issuer": "Hole Shop", "algorithm": "SHA1", "digits": "6", "period": "30",
+	} {
+		if q.Get(key) != want {
+			t.Errorf("%s = %q, want %q", key, q.Get(key), want)
+		}
+	}
+}
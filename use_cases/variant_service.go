@@ -0,0 +1,168 @@
+package use_cases
+
+import (
+	"errors"
+	"hole/entities"
+	"regexp"
+	"strings"
+)
+
+const (
+	maxVariantOptions    = 10
+	maxOptionNameLength  = 30
+	maxOptionValueLength = 100
+	maxImageKeyLength    = 255
+)
+
+var (
+	ErrInvalidVariant   = errors.New("sku must be 1 to 64 letters, digits, '.', '_' or '-', with at most 10 options of non-empty names and values")
+	ErrDuplicateVariant = errors.New("another variant of this item has the same options")
+)
+
+var skuPattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9._-]{0,63}$`)
+
+type VariantRepository interface {
+	// Create stores a variant and records its initial stock as adjusted by
+	// actorID.
+	Create(variant *entities.Variant, actorID uint) error
+	FindByID(itemID, id uint) (*entities.Variant, error)
+	ListByItem(itemID uint) ([]*entities.Variant, error)
+	Update(variant *entities.Variant) error
+	Delete(itemID, id uint) error
+}
+
+// VariantFields are the client-supplied attributes of a variant. Stock is
+// the initial stock and is ignored on update.
+type VariantFields struct {
+	SKU        string
+	Options    map[string]string
+	PriceMinor *int64
+	ImageKey   string
+	Stock      int
+}
+
+type VariantUseCase struct {
+	items    ItemRepository
+	variants VariantRepository
+}
+
+func NewVariantUseCase(items ItemRepository, variants VariantRepository) *VariantUseCase {
+	return &VariantUseCase{items: items, variants: variants}
+}
+
+func (uc *VariantUseCase) List(itemID uint) ([]*entities.Variant, error) {
+	if _, err := uc.items.FindByID(itemID); err != nil {
+		return nil, err
+	}
+	return uc.variants.ListByItem(itemID)
+}
+
+func (uc *VariantUseCase) Get(itemID, id uint) (*entities.Variant, error) {
+	return uc.variants.FindByID(itemID, id)
+}
+
+// Create adds a variant to an item owned by the caller, or to any item for
+// admins.
+func (uc *VariantUseCase) Create(userID uint, role entities.Role, itemID uint, f VariantFields) (*entities.Variant, error) {
+	item, err := authorizeItem(uc.items, userID, role, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if f.Stock < 0 {
+		return nil, ErrInvalidStock
+	}
+
+	variant, err := uc.newVariant(item, 0, f)
+	if err != nil {
+		return nil, err
+	}
+	variant.Stock = f.Stock
+
+	if err := uc.variants.Create(variant, userID); err != nil {
+		return nil, err
+	}
+	return variant, nil
+}
+
+// Update replaces the SKU, options, price override and image of a variant.
+// Its stock changes only through inventory adjustments.
+func (uc *VariantUseCase) Update(userID uint, role entities.Role, itemID, id uint, f VariantFields) (*entities.Variant, error) {
+	item, err := authorizeItem(uc.items, userID, role, itemID)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := uc.variants.FindByID(itemID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	variant, err := uc.newVariant(item, id, f)
+	if err != nil {
+		return nil, err
+	}
+	variant.ID = existing.ID
+	variant.Stock = existing.Stock
+	variant.CreatedAt = existing.CreatedAt
+
+	if err := uc.variants.Update(variant); err != nil {
+		return nil, err
+	}
+	return variant, nil
+}
+
+func (uc *VariantUseCase) Delete(userID uint, role entities.Role, itemID, id uint) error {
+	if _, err := authorizeItem(uc.items, userID, role, itemID); err != nil {
+		return err
+	}
+	return uc.variants.Delete(itemID, id)
+}
+
+// newVariant validates f for a variant of item. Variant id, if non-zero, is
+// skipped when checking for duplicate options.
+func (uc *VariantUseCase) newVariant(item *entities.Item, id uint, f VariantFields) (*entities.Variant, error) {
+	sku := strings.ToUpper(strings.TrimSpace(f.SKU))
+	if !skuPattern.MatchString(sku) || len(f.Options) > maxVariantOptions || len(f.ImageKey) > maxImageKeyLength {
+		return nil, ErrInvalidVariant
+	}
+
+	options := entities.VariantOptions{}
+	for name, value := range f.Options {
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if name == "" || value == "" || len(name) > maxOptionNameLength || len(value) > maxOptionValueLength {
+			return nil, ErrInvalidVariant
+		}
+		if _, dup := options[name]; dup {
+			return nil, ErrInvalidVariant
+		}
+		options[name] = value
+	}
+
+	if f.PriceMinor != nil {
+		if *f.PriceMinor < 0 {
+			return nil, ErrInvalidPrice
+		}
+		// The override is in the currency of the item
+		if item.Currency == "" {
+			return nil, ErrInvalidCurrency
+		}
+	}
+
+	siblings, err := uc.variants.ListByItem(item.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	for _, sibling := range siblings {
+		if sibling.ID != id && sibling.Options.Equal(options) {
+			return nil, ErrDuplicateVariant
+		}
+	}
+
+	return &entities.Variant{
+		ItemID:     item.ProductID,
+		SKU:        sku,
+		Options:    options,
+		PriceMinor: f.PriceMinor,
+		ImageKey:   f.ImageKey,
+	}, nil
+}
@@ -0,0 +1,177 @@
+package use_cases
+
+import (
+	"errors"
+	"fmt"
+	"hole/entities"
+	"log"
+	"net/url"
+	"time"
+)
+
+var (
+	ErrAlreadyVerified = errors.New("email already verified")
+	ErrResendTooSoon   = errors.New("verification email sent too recently")
+)
+
+type OneTimeTokenRepository interface {
+	Create(token *entities.OneTimeToken) error
+	// Consume atomically marks an unused, unexpired token as used.
+	Consume(purpose, token string, now time.Time) (*entities.OneTimeToken, error)
+	ConsumeBound(purpose, token, binding string, now time.Time) (*entities.OneTimeToken, error)
+	Latest(userID uint, purpose string) (*entities.OneTimeToken, error)
+	InvalidateAll(userID uint, purpose string, now time.Time) error
+}
+
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+type VerificationSettings struct {
+	// BaseURL is used to build links sent by email.
+	BaseURL        string
+	TokenTTL       time.Duration
+	ResendInterval time.Duration
+}
+
+type VerificationUseCase struct {
+	users    UserRepository
+	tokens   OneTimeTokenRepository
+	mailer   Mailer
+	settings VerificationSettings
+}
+
+func NewVerificationUseCase(users UserRepository, tokens OneTimeTokenRepository, mailer Mailer, settings VerificationSettings) *VerificationUseCase {
+	return &VerificationUseCase{users: users, tokens: tokens, mailer: mailer, settings: settings}
+}
+
+// SendVerification issues a new verification link, invalidating earlier ones.
+func (uc *VerificationUseCase) SendVerification(user *entities.User) error {
+	if user.Verified() {
+		return ErrAlreadyVerified
+	}
+
+	now := time.Now()
+	if err := uc.tokens.InvalidateAll(user.ID, entities.TokenPurposeVerifyEmail, now); err != nil {
+		return err
+	}
+
+	token := randomToken(32)
+	if err := uc.tokens.Create(&entities.OneTimeToken{
+		UserID:    user.ID,
+		Purpose:   entities.TokenPurposeVerifyEmail,
+		Token:     token,
+		Email:     user.Email,
+		ExpiresAt: now.Add(uc.settings.TokenTTL),
+	}); err != nil {
+		return err
+	}
+
+	link := uc.settings.BaseURL + "/verify?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Confirm your email address by opening this link:\n\n%s\n\nThe link expires in %s.",
+		link, uc.settings.TokenTTL)
+
+	return uc.mailer.Send(user.Email, "Verify your email address", body)
+}
+
+// Resend sends a fresh link unless one was sent within ResendInterval.
+func (uc *VerificationUseCase) Resend(userID uint) error {
+	user, err := uc.users.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.Verified() {
+		return ErrAlreadyVerified
+	}
+
+	latest, err := uc.tokens.Latest(userID, entities.TokenPurposeVerifyEmail)
+	if err != nil && !errors.Is(err, entities.ErrInvalidToken) {
+		return err
+	}
+	if latest != nil && time.Since(latest.CreatedAt) < uc.settings.ResendInterval {
+		return ErrResendTooSoon
+	}
+
+	return uc.SendVerification(user)
+}
+
+// Verify consumes a link sent by SendVerification or RequestEmailChange.
+func (uc *VerificationUseCase) Verify(token string) error {
+	now := time.Now()
+	t, err := uc.tokens.Consume(entities.TokenPurposeVerifyEmail, token, now)
+	if errors.Is(err, entities.ErrInvalidToken) {
+		return uc.confirmEmailChange(token, now)
+	}
+	if err != nil {
+		return err
+	}
+
+	user, err := uc.users.FindByID(t.UserID)
+	if err != nil {
+		return err
+	}
+	// The link only proves ownership of the address it was sent to
+	if user.Email != t.Email {
+		return entities.ErrInvalidToken
+	}
+
+	return uc.users.MarkVerified(user.ID, now)
+}
+
+// RequestEmailChange sends a confirmation link to the new address. The
+// account keeps its current email until the link is opened.
+func (uc *VerificationUseCase) RequestEmailChange(user *entities.User, newEmail string) error {
+	newEmail = NormalizeEmail(newEmail)
+	if err := ValidateEmail(newEmail); err != nil {
+		return err
+	}
+	if newEmail == user.Email {
+		return nil
+	}
+
+	existing, err := uc.users.FindByEmail(newEmail)
+	if err != nil && !errors.Is(err, entities.ErrUserNotFound) {
+		return err
+	}
+	if existing != nil {
+		return entities.ErrEmailTaken
+	}
+
+	now := time.Now()
+	if err := uc.tokens.InvalidateAll(user.ID, entities.TokenPurposeChangeEmail, now); err != nil {
+		return err
+	}
+
+	token := randomToken(32)
+	if err := uc.tokens.Create(&entities.OneTimeToken{
+		UserID:    user.ID,
+		Purpose:   entities.TokenPurposeChangeEmail,
+		Token:     token,
+		Email:     newEmail,
+		ExpiresAt: now.Add(uc.settings.TokenTTL),
+	}); err != nil {
+		return err
+	}
+
+	link := uc.settings.BaseURL + "/verify?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Confirm %s as the new email address of your account by opening this link:\n\n%s\n\nThe link expires in %s.",
+		newEmail, link, uc.settings.TokenTTL)
+
+	return uc.mailer.Send(newEmail, "Confirm your new email address", body)
+}
+
+func (uc *VerificationUseCase) confirmEmailChange(token string, now time.Time) error {
+	t, err := uc.tokens.Consume(entities.TokenPurposeChangeEmail, token, now)
+	if err != nil {
+		return err
+	}
+	return uc.users.UpdateEmail(t.UserID, t.Email, now)
+}
+
+// sendAfterRegister is used by AuthUseCase.Register; a failure is logged rather
+// than failing the registration because the user can ask for a resend.
+func (uc *VerificationUseCase) sendAfterRegister(user *entities.User) {
+	if err := uc.SendVerification(user); err != nil {
+		log.Printf("failed to send verification email to user %d: %v", user.ID, err)
+	}
+}